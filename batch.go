@@ -0,0 +1,273 @@
+package go_ohm
+
+import (
+	"context"
+	"reflect"
+)
+
+// LoadMany loads a batch of data structs from redis hashes. All commands of the
+// batch are pipelined, so the round trips are as many as a single Load().
+//
+// `keys` are hash names of the data structs, they override `opts.HashName`.
+//
+// `i` is a pointer to slice, which element type is supported by Load(). The
+// slice is resized to len(keys), and the n-th element is loaded from the n-th
+// key.
+//
+// Failures of some elements do not abort the batch. If any element failed, it
+// returns `ErrorBatchFailed`, which contains error of every element. The failed
+// elements are left untouched. See Load() for other arguments.
+func LoadMany(conn Conn, ns string, opts *ObjectOptions, keys []string,
+	i interface{}) error {
+	return LoadManyContext(context.Background(), conn, ns, opts, keys, i)
+}
+
+// LoadManyContext is like LoadMany(), but with context. See LoadContext().
+func LoadManyContext(ctx context.Context, conn Conn, ns string,
+	opts *ObjectOptions, keys []string, i interface{}) error {
+	v := reflect.ValueOf(i)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return newErrorUnsupportedObjectType(rootObjectName)
+	}
+
+	sv := v.Elem()
+	if sv.Len() != len(keys) {
+		sv.Set(reflect.MakeSlice(sv.Type(), len(keys), len(keys)))
+	}
+
+	batch, errs := genBatchObjectList(sv, ObjectOpLoad, opts, keys)
+	loadErrs := doBatchLoadCommands(ctx, conn, ns, batch, opts.Watch)
+	for n, objs := range batch {
+		if errs[n] != nil {
+			continue
+		} else if loadErrs[n] != nil {
+			errs[n] = loadErrs[n]
+			continue
+		}
+
+		errs[n] = objs[0].renderValue()
+	}
+
+	return newErrorBatchFailed(errs)
+}
+
+// SaveMany saves a batch of data structs to redis hashes. All commands of the
+// batch are pipelined. If `opts.Atomic` is true, the whole batch is saved in a
+// single transaction.
+//
+// `i` is a slice or pointer to slice, the n-th element is saved to the n-th
+// key. See LoadMany() for other arguments.
+func SaveMany(conn Conn, ns string, opts *ObjectOptions, keys []string,
+	i interface{}) error {
+	return SaveManyContext(context.Background(), conn, ns, opts, keys, i)
+}
+
+// SaveManyContext is like SaveMany(), but with context. See SaveContext().
+func SaveManyContext(ctx context.Context, conn Conn, ns string,
+	opts *ObjectOptions, keys []string, i interface{}) error {
+	sv := reflect.ValueOf(i)
+	if sv.Kind() == reflect.Ptr && !sv.IsNil() {
+		sv = sv.Elem()
+	}
+
+	if sv.Kind() != reflect.Slice || sv.Len() != len(keys) {
+		return newErrorUnsupportedObjectType(rootObjectName)
+	}
+
+	batch, errs := genBatchObjectList(sv, ObjectOpSave, opts, keys)
+	saveErrs := doBatchSaveCommands(ctx, conn, ns, batch, opts.Atomic)
+	for n := range batch {
+		if errs[n] == nil {
+			errs[n] = saveErrs[n]
+		}
+	}
+
+	return newErrorBatchFailed(errs)
+}
+
+// genBatchObjectList generates object list for every element of slice `sv`.
+// Elements failed to generate have nil object list and non-nil error.
+func genBatchObjectList(sv reflect.Value, op uint, opts *ObjectOptions,
+	keys []string) ([][]*compoundObject, []error) {
+	batch := make([][]*compoundObject, sv.Len())
+	errs := make([]error, sv.Len())
+	for n := 0; n < sv.Len(); n++ {
+		elemOpts := *opts
+		elemOpts.HashName = keys[n]
+		batch[n], errs[n] = genObjectList(sv.Index(n).Addr().Interface(), op,
+			&elemOpts, nil)
+	}
+
+	return batch, errs
+}
+
+// collectBatchErrors stores errors of commands to errors of their owners. If
+// commands failed as a whole, `err` is stored to all owners.
+func collectBatchErrors(errs []error, cmds []*redisCommand, owners []int,
+	err error) {
+	fatal := err != nil
+	for n, cmd := range cmds {
+		if cmd.err != nil {
+			fatal = false
+			if errs[owners[n]] == nil {
+				errs[owners[n]] = cmd.err
+			}
+		}
+	}
+
+	if fatal {
+		for _, o := range owners {
+			if errs[o] == nil {
+				errs[o] = err
+			}
+		}
+	}
+}
+
+// doBatchLoadCommands is like doLoadCommands(), but loads multiple object
+// lists together. Nil object lists are skipped. It returns error of every
+// object list.
+func doBatchLoadCommands(ctx context.Context, conn Conn, ns string,
+	batch [][]*compoundObject, watch bool) []error {
+	errs := make([]error, len(batch))
+	levels := make([][][]*compoundObject, len(batch))
+	maxLevel := 0
+	for n, objs := range batch {
+		levels[n] = groupByLoadLevel(objs)
+		if len(levels[n]) > maxLevel {
+			maxLevel = len(levels[n])
+		}
+	}
+
+	for l := 0; l < maxLevel; l++ {
+		doBatchLevelCommands(ctx, conn, levels, l, errs,
+			func(level []*compoundObject) ([]*redisCommand, error) {
+				return genLevelLoadCommands(ns, level, watch)
+			})
+
+		// maps loaded by scan take more round trips.
+		for {
+			n := doBatchLevelCommands(ctx, conn, levels, l, errs,
+				func(level []*compoundObject) ([]*redisCommand, error) {
+					return genLevelScanCommands(ns, level)
+				})
+			if n <= 0 {
+				break
+			}
+		}
+
+		for n := range batch {
+			if errs[n] == nil && l < len(levels[n]) {
+				errs[n] = checkLevelNotFound(ns, levels[n][l])
+			}
+		}
+	}
+
+	return errs
+}
+
+// doBatchLevelCommands generates commands of level `l` of every object list by
+// `gen`, and executes them in one pipeline. Object lists which have failed are
+// skipped, and errors are stored to `errs`. It returns the number of commands.
+func doBatchLevelCommands(ctx context.Context, conn Conn,
+	levels [][][]*compoundObject, l int, errs []error,
+	gen func(level []*compoundObject) ([]*redisCommand, error)) int {
+	var cmds []*redisCommand
+	var owners []int
+	for n := range levels {
+		if errs[n] != nil || l >= len(levels[n]) {
+			continue
+		}
+
+		c, err := gen(levels[n][l])
+		if err != nil {
+			errs[n] = err
+			continue
+		}
+
+		cmds = append(cmds, c...)
+		for range c {
+			owners = append(owners, n)
+		}
+	}
+
+	err := doRedisPipeline(ctx, conn, cmds)
+	collectBatchErrors(errs, cmds, owners, err)
+	return len(cmds)
+}
+
+// doBatchSaveCommands is like doSaveCommands(), but saves multiple object
+// lists together. Nil object lists are skipped. It returns error of every
+// object list.
+func doBatchSaveCommands(ctx context.Context, conn Conn, ns string,
+	batch [][]*compoundObject, atomic bool) []error {
+	errs := make([]error, len(batch))
+
+	var cmds, checks []*redisCommand
+	var owners, checkOwners []int
+	for n, objs := range batch {
+		if len(objs) <= 0 {
+			continue
+		}
+
+		c, err := genSaveCommands(ns, objs)
+		if err != nil {
+			errs[n] = err
+			continue
+		}
+
+		cmds = append(cmds, c...)
+		for range c {
+			owners = append(owners, n)
+		}
+
+		if !atomic {
+			continue
+		}
+
+		c, err = genVersionCheckCommands(ns, objs)
+		if err != nil {
+			errs[n] = err
+			continue
+		}
+
+		checks = append(checks, c...)
+		for range c {
+			checkOwners = append(checkOwners, n)
+		}
+	}
+
+	var err error
+	if atomic {
+		// check versions before the transaction, so nothing is saved on
+		// conflicts. The versioned hashes are watched, so they can not be
+		// modified by others in between.
+		err = doRedisPipeline(ctx, conn, checks)
+		if err != nil {
+			doContext(ctx, conn, "UNWATCH")
+			collectBatchErrors(errs, checks, checkOwners, err)
+			for n := range errs {
+				if errs[n] == nil && len(batch[n]) > 0 {
+					errs[n] = err
+				}
+			}
+			return errs
+		}
+
+		err = doRedisTransaction(ctx, conn, cmds)
+	} else {
+		err = doRedisPipeline(ctx, conn, cmds)
+	}
+	collectBatchErrors(errs, cmds, owners, err)
+
+	// failed to UNWATCH while there is nothing to save.
+	if len(cmds) <= 0 && err != nil {
+		for n := range errs {
+			if errs[n] == nil {
+				errs[n] = err
+			}
+		}
+	}
+
+	return errs
+}
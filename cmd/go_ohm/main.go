@@ -0,0 +1,78 @@
+// Command go_ohm generates reflection free `HashFields()` and `FromHash()`
+// methods for structs, which implement `go_ohm.HashMarshaler` and
+// `go_ohm.HashUnmarshaler`, so Load() and Save() map the structs' plain fields
+// without reflection. The methods read the same struct tags as the reflective
+// path, and store the same redis layout.
+//
+// Usage:
+//
+//	go_ohm -type=T1,T2 [-output=file] [directory | files...]
+//
+// Typically used by go generate:
+//
+//	//go:generate go_ohm -type=User
+//
+// Fields of compound types stored in their own hashes are still mapped by
+// reflection. Promoted structs, embedded fields, interfaces and multiple level
+// pointers are unsupported.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/abadcafe/go_ohm/internal/gen"
+)
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of struct type "+
+		"names; required")
+	output = flag.String("output", "", "output file name; default "+
+		"srcdir/<type>_ohm.go")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: go_ohm -type=T1,T2 [-output=file] "+
+		"[directory | files...]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if *typeNames == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	types := strings.Split(*typeNames, ",")
+	paths := flag.Args()
+	if len(paths) <= 0 {
+		paths = []string{"."}
+	}
+
+	src, err := gen.Generate(paths, types)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "go_ohm: %v\n", err)
+		os.Exit(1)
+	}
+
+	out := *output
+	if out == "" {
+		dir := paths[0]
+		if len(paths) > 1 || strings.HasSuffix(dir, ".go") {
+			dir = filepath.Dir(dir)
+		}
+		out = filepath.Join(dir, strings.ToLower(types[0])+"_ohm.go")
+	}
+
+	err = ioutil.WriteFile(out, src, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "go_ohm: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,128 @@
+package go_ohm
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Codec encodes jsonified fields and map elements. See `ObjectOptions.Codec`.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+const defaultCodecName = "json"
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// codecs are registered codecs, the key is name, and value is Codec.
+var codecs sync.Map
+
+func init() {
+	RegisterCodec(defaultCodecName, jsonCodec{})
+	RegisterCodec("gob", gobCodec{})
+}
+
+// RegisterCodec registers codec `c` as `name`, which can be used by
+// `ObjectOptions.Codec` then. "json" and "gob" are registered by default, and
+// the package "github.com/abadcafe/go_ohm/msgpack" registers "msgpack".
+func RegisterCodec(name string, c Codec) {
+	codecs.Store(name, c)
+}
+
+// newErrorValueCodecFailed keeps `ErrorJsonFailed` for the json codec.
+func newErrorValueCodecFailed(nam string, codec string, err error) error {
+	if codec == "" || codec == defaultCodecName {
+		return newErrorJsonFailed(nam, err)
+	}
+	return newErrorCodecFailed(nam, codec, err)
+}
+
+func getCodec(nam string, codec string) (Codec, error) {
+	if codec == "" {
+		codec = defaultCodecName
+	}
+
+	c, ok := codecs.Load(codec)
+	if !ok {
+		return nil, newErrorCodecFailed(nam, codec,
+			fmt.Errorf("unregistered codec"))
+	}
+	return c.(Codec), nil
+}
+
+// marshalValue encodes value `v` of object `nam` by codec `codec`, "" means the
+// default.
+func marshalValue(nam string, codec string, v *reflect.Value) ([]byte, error) {
+	c, err := getCodec(nam, codec)
+	if err != nil {
+		return nil, err
+	}
+
+	var i interface{}
+	if v.Kind() == reflect.Ptr {
+		i = v.Interface()
+	} else {
+		p := reflect.New(v.Type())
+		p.Elem().Set(*v)
+		i = p.Interface()
+	}
+
+	bs, err := c.Marshal(i)
+	if err != nil {
+		return nil, newErrorValueCodecFailed(nam, codec, err)
+	}
+
+	return bs, nil
+}
+
+// unmarshalValue decodes `bs` into value `v` of object `nam` by codec `codec`,
+// "" means the default.
+func unmarshalValue(nam string, codec string, bs []byte,
+	v *reflect.Value) error {
+	c, err := getCodec(nam, codec)
+	if err != nil {
+		return err
+	}
+
+	var i interface{}
+	if v.Kind() == reflect.Ptr {
+		i = v.Interface()
+	} else {
+		i = v.Addr().Interface()
+	}
+
+	err = c.Unmarshal(bs, i)
+	if err != nil {
+		return newErrorValueCodecFailed(nam, codec, err)
+	}
+
+	return nil
+}
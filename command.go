@@ -0,0 +1,285 @@
+package go_ohm
+
+import (
+	"context"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Conn is the redis connection which objects talk to. The `redis.Conn` of
+// redigo (https://github.com/gomodule/redigo) implements it, and is the
+// default driver. To use other drivers, implement it with an adapter, see sub
+// package `goredis` for example.
+//
+// The methods have the same semantics as redigo's. Especially, replies must be
+// in redigo's format: bulk strings are []byte, integers are int64, arrays are
+// []interface{}, nil is nil, and error replies are `redis.Error` of redigo.
+type Conn interface {
+	// Do sends a command to the server and returns the received reply.
+	Do(commandName string, args ...interface{}) (reply interface{}, err error)
+
+	// Send writes the command to the client's output buffer.
+	Send(commandName string, args ...interface{}) error
+
+	// Flush flushes the output buffer to the Redis server.
+	Flush() error
+
+	// Receive receives a single reply from the Redis server.
+	Receive() (reply interface{}, err error)
+}
+
+// ConnWithContext is an optional interface of `Conn`, which allows
+// LoadContext() and SaveContext() to control commands' life with context. The
+// redigo's connection implements it.
+type ConnWithContext interface {
+	Conn
+
+	// DoContext sends a command to server and returns the received reply.
+	DoContext(ctx context.Context, commandName string,
+		args ...interface{}) (reply interface{}, err error)
+
+	// ReceiveContext receives a single reply from the Redis server.
+	ReceiveContext(ctx context.Context) (reply interface{}, err error)
+}
+
+func doContext(ctx context.Context, conn Conn, commandName string,
+	args ...interface{}) (interface{}, error) {
+	if cc, ok := conn.(ConnWithContext); ok {
+		return cc.DoContext(ctx, commandName, args...)
+	}
+
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return conn.Do(commandName, args...)
+}
+
+func receiveContext(ctx context.Context, conn Conn) (interface{}, error) {
+	if cc, ok := conn.(ConnWithContext); ok {
+		return cc.ReceiveContext(ctx)
+	}
+
+	return conn.Receive()
+}
+
+// COUNT argument of SCAN family commands.
+const scanCount = 100
+
+// redisCommand is a redis command generated by a compound object.
+type redisCommand struct {
+	obj  *compoundObject
+	name string
+	args []interface{}
+
+	// handle the reply of the command, can be nil if the reply is useless.
+	replyHandler func(reply interface{}) error
+
+	// error of execution or reply handling.
+	err error
+}
+
+func newRedisCommand(obj *compoundObject, name string, args []interface{},
+	handler func(reply interface{}) error) *redisCommand {
+	return &redisCommand{
+		obj:          obj,
+		name:         name,
+		args:         args,
+		replyHandler: handler,
+	}
+}
+
+func (c *redisCommand) handleReply(reply interface{}) {
+	if c.replyHandler != nil {
+		c.err = c.replyHandler(reply)
+	}
+}
+
+// doRedisPipeline sends all commands in one round trip, then receives and
+// handles their replies in order. All replies are received even if some of
+// them are error replies, so the connection is still usable. But it stops at
+// the first error of the connection or the context, and stores the error in
+// the remaining commands. The error of every command is stored in the command,
+// and it returns the first error.
+func doRedisPipeline(ctx context.Context, conn Conn,
+	cmds []*redisCommand) error {
+	if len(cmds) <= 0 {
+		return nil
+	}
+
+	err := ctx.Err()
+	if err != nil {
+		return newErrorRedisCommandFailed(cmds[0].obj.name, err)
+	}
+
+	for _, cmd := range cmds {
+		err := conn.Send(cmd.name, cmd.args...)
+		if err != nil {
+			return newErrorRedisCommandFailed(cmd.obj.name, err)
+		}
+	}
+
+	err = conn.Flush()
+	if err != nil {
+		return newErrorRedisCommandFailed(cmds[0].obj.name, err)
+	}
+
+	var firstErr error
+	for i, cmd := range cmds {
+		rep, err := receiveContext(ctx, conn)
+		if err != nil && !isRedisErrorReply(err) {
+			// the connection is broken or the context is done, the remaining
+			// replies can not be received.
+			err = newErrorRedisCommandFailed(cmd.obj.name, err)
+			for _, cmd := range cmds[i:] {
+				cmd.err = err
+			}
+			return err
+		} else if err != nil {
+			cmd.err = newErrorRedisCommandFailed(cmd.obj.name, err)
+		} else {
+			cmd.handleReply(rep)
+		}
+
+		if cmd.err != nil && firstErr == nil {
+			firstErr = cmd.err
+		}
+	}
+
+	return firstErr
+}
+
+// isRedisErrorReply reports whether `err` is an error reply of a command,
+// rather than an error of the connection or the context.
+func isRedisErrorReply(err error) bool {
+	_, ok := err.(redis.Error)
+	return ok
+}
+
+// doRedisTransaction is like doRedisPipeline(), but wraps commands with MULTI
+// and EXEC, so they are executed atomically. If EXEC is aborted because of
+// watched keys were modified, it returns `ErrorTransactionConflict`. If there
+// is no command, it sends UNWATCH instead, to release keys watched by Load().
+func doRedisTransaction(ctx context.Context, conn Conn,
+	cmds []*redisCommand) error {
+	if len(cmds) <= 0 {
+		_, err := doContext(ctx, conn, "UNWATCH")
+		if err != nil {
+			return newErrorRedisCommandFailed(rootObjectName, err)
+		}
+		return nil
+	}
+
+	nam := cmds[0].obj.name
+	err := ctx.Err()
+	if err != nil {
+		return newErrorRedisCommandFailed(nam, err)
+	}
+
+	err = conn.Send("MULTI")
+	if err != nil {
+		return newErrorRedisCommandFailed(nam, err)
+	}
+
+	for i, cmd := range cmds {
+		err := conn.Send(cmd.name, cmd.args...)
+		if err != nil {
+			discardRedisTransaction(ctx, conn, i+1)
+			return newErrorRedisCommandFailed(cmd.obj.name, err)
+		}
+	}
+
+	err = conn.Send("EXEC")
+	if err != nil {
+		discardRedisTransaction(ctx, conn, len(cmds)+1)
+		return newErrorRedisCommandFailed(nam, err)
+	}
+
+	err = conn.Flush()
+	if err != nil {
+		return newErrorRedisCommandFailed(nam, err)
+	}
+
+	// reply of MULTI, only error is meaningful.
+	var firstErr error
+	_, err = receiveContext(ctx, conn)
+	if err != nil {
+		firstErr = newErrorRedisCommandFailed(nam, err)
+	}
+
+	// replies of queued commands, only errors are meaningful. Stop at the
+	// first error of the connection or the context, since the remaining
+	// replies can not be received.
+	fatal := err != nil && !isRedisErrorReply(err)
+	for _, cmd := range cmds {
+		if fatal {
+			break
+		}
+
+		_, err := receiveContext(ctx, conn)
+		if err != nil {
+			cmd.err = newErrorRedisCommandFailed(cmd.obj.name, err)
+			if firstErr == nil {
+				firstErr = cmd.err
+			}
+			fatal = !isRedisErrorReply(err)
+		}
+	}
+
+	var rep []interface{}
+	if !fatal {
+		rep, err = redis.Values(receiveContext(ctx, conn))
+	}
+	if firstErr == nil {
+		if err == redis.ErrNil {
+			firstErr = newErrorTransactionConflict(nam)
+		} else if err != nil {
+			firstErr = newErrorRedisCommandFailed(nam, err)
+		} else if len(rep) != len(cmds) {
+			firstErr = newErrorBugOccurred(nam)
+		}
+	}
+
+	if firstErr != nil {
+		// the transaction is aborted, none of the commands is executed.
+		for _, cmd := range cmds {
+			if cmd.err == nil {
+				cmd.err = firstErr
+			}
+		}
+		return firstErr
+	}
+
+	for i, cmd := range cmds {
+		if e, ok := rep[i].(redis.Error); ok {
+			cmd.err = newErrorRedisCommandFailed(cmd.obj.name, e)
+		} else {
+			cmd.handleReply(rep[i])
+		}
+
+		if cmd.err != nil && firstErr == nil {
+			firstErr = cmd.err
+		}
+	}
+
+	return firstErr
+}
+
+// discardRedisTransaction aborts a transaction whose first `sent` commands,
+// including MULTI, have been sent, and drains their replies, so the connection
+// is neither left in the MULTI state nor with unread replies. Errors are
+// ignored, because the caller is already failing.
+func discardRedisTransaction(ctx context.Context, conn Conn, sent int) {
+	err := conn.Send("DISCARD")
+	if err == nil {
+		err = conn.Flush()
+	}
+
+	for i := 0; err == nil && i <= sent; i++ {
+		_, err = receiveContext(ctx, conn)
+		if err != nil && isRedisErrorReply(err) {
+			err = nil
+		}
+	}
+}
@@ -2,20 +2,45 @@ package go_ohm
 
 import (
 	"strings"
-
-	"github.com/gomodule/redigo/redis"
+	"time"
 )
 
 type abstractCompoundObject interface {
 	abstractObject
 	getDescendants(objList *[]*compoundObject)
-	doRedisLoad(conn redis.Conn, ns string) error
+	genLoadCommands(ns string) ([]*redisCommand, error)
 	genHashFieldValuePairs() ([]interface{}, error)
 }
 
 type compoundObject struct {
 	*object
 	abstractCompoundObject
+
+	// the hash does not exist while loading.
+	notFound bool
+}
+
+func (o *compoundObject) isAncestorNotFound() bool {
+	for obj := o.parent; obj != nil; obj = obj.parent {
+		if obj.notFound {
+			return true
+		}
+	}
+
+	return false
+}
+
+// renderValue leaves the value untouched if the hash is not found, unless the
+// load mode is "reset".
+func (o *compoundObject) renderValue() error {
+	if o.notFound {
+		if o.getLoadMode() == "reset" {
+			o.resetValue()
+		}
+		return nil
+	}
+
+	return o.abstractCompoundObject.renderValue()
 }
 
 // The caller should check if return value is "".
@@ -52,9 +77,33 @@ func (o *compoundObject) genHashName() string {
 		return ""
 	}
 
+	if o.op == ObjectOpSave {
+		// while saving, the referenced field is not loaded from redis, use its
+		// in-memory value instead.
+		v, err := po.genHashValue()
+		if err != nil {
+			return ""
+		}
+		return v
+	}
+
 	return string(po.reply)
 }
 
+// isCascadable reports whether the object is referred from the root object
+// through `reference` fields only, which means it is owned by the root object.
+func (o *compoundObject) isCascadable() bool {
+	for obj := o; obj.parent != nil; obj = obj.parent {
+		if obj.isPromotedObject() {
+			continue
+		} else if obj.Reference == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (o *compoundObject) genRedisKey(ns string) (string, error) {
 	key := o.genHashName()
 	if key == "" {
@@ -66,25 +115,142 @@ func (o *compoundObject) genRedisKey(ns string) (string, error) {
 	return redisKey, nil
 }
 
-func (o *compoundObject) doRedisSave(conn redis.Conn, ns string) error {
+// getLoadLevel returns how many `reference` fields are between the root object
+// and the object. Hash name of an object depends on replies of its ancestors,
+// so objects must be loaded level by level.
+func (o *compoundObject) getLoadLevel() int {
+	level := 0
+	for obj := o; obj.parent != nil; obj = obj.parent {
+		if obj.Reference != "" {
+			level++
+		}
+	}
+
+	return level
+}
+
+// getTTL returns the expiration of the hash and whether it is sliding. Both of
+// them are inherited from ancestors if not presented.
+func (o *compoundObject) getTTL() (time.Duration, bool) {
+	ttl := time.Duration(0)
+	sliding := false
+	for obj := o; obj != nil; obj = obj.parent {
+		if ttl <= 0 {
+			ttl = obj.TTL
+		}
+		sliding = sliding || obj.SlidingTTL
+	}
+
+	// PEXPIRE with 0 deletes the hash, so round positive TTLs under 1ms up.
+	if ttl > 0 && ttl < time.Millisecond {
+		ttl = time.Millisecond
+	}
+
+	return ttl, sliding
+}
+
+// genExpireCommands returns the command to set the hash's expiration. While
+// loading, only sliding expiration is refreshed.
+func (o *compoundObject) genExpireCommands(key string) []*redisCommand {
+	ttl, sliding := o.getTTL()
+	if ttl <= 0 || (o.op == ObjectOpLoad && !sliding) {
+		return nil
+	}
+
+	args := []interface{}{key, ttl.Milliseconds()}
+	return []*redisCommand{newRedisCommand(o, "PEXPIRE", args, nil)}
+}
+
+// getVersionField returns the version field of struct, or nil.
+func (o *compoundObject) getVersionField() *plainObject {
+	so, ok := o.abstractCompoundObject.(*structObject)
+	if !ok {
+		return nil
+	}
+
+	return so.getVersionField()
+}
+
+func (o *compoundObject) genSaveCommands(ns string) ([]*redisCommand, error) {
+	if o.parent != nil && o.isNil() {
+		// nothing to save for nil descendants.
+		return nil, nil
+	}
+
 	key, err := o.genRedisKey(ns)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	cmdArgs, err := o.genHashFieldValuePairs()
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if mo, ok := o.abstractCompoundObject.(*mapObject); ok &&
+		o.getMapMode() == "replace" {
+		cmds := mo.genReplaceCommands(key, cmdArgs)
+		cmds = append(cmds, o.genExpireCommands(key)...)
+		return cmds, nil
+	} else if len(cmdArgs) <= 0 {
+		// HMSET requires at least one field value pair.
+		return nil, nil
+	}
+
+	if vf := o.getVersionField(); vf != nil {
+		so := o.abstractCompoundObject.(*structObject)
+		// the expiration is set by the script.
+		return so.genVersionedSaveCommands(key, cmdArgs, vf)
 	}
 
 	args := []interface{}{key}
 	args = append(args, cmdArgs...)
-	_, err = conn.Do("HMSET", args...)
+	cmds := []*redisCommand{newRedisCommand(o, "HMSET", args, nil)}
+	cmds = append(cmds, o.genExpireCommands(key)...)
+	return cmds, nil
+}
+
+// genVersionCheckCommands generates commands to WATCH the hash and check its
+// version before an atomic save, so a version conflict aborts the whole
+// transaction, rather than the save of the versioned hash only.
+func (o *compoundObject) genVersionCheckCommands(
+	ns string) ([]*redisCommand, error) {
+	if o.parent != nil && o.isNil() {
+		return nil, nil
+	}
+
+	vf := o.getVersionField()
+	if vf == nil {
+		return nil, nil
+	}
+
+	key, err := o.genRedisKey(ns)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	so := o.abstractCompoundObject.(*structObject)
+	return so.genVersionCheckCommands(key, vf)
+}
+
+// genRedisKeyPattern returns the glob pattern matches all redis keys of the
+// object's type.
+func (o *compoundObject) genRedisKeyPattern(ns string) string {
+	hashPrefix := o.genHashPrefix()
+	parts := []string{escapeGlob(ns), escapeGlob(hashPrefix), "*"}
+	return strings.Join(parts, "#")
+}
+
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(`*?[]\`, c) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
 	}
 
-	return nil
+	return b.String()
 }
 
 func newCompoundObject(o *object) (*compoundObject, error) {
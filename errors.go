@@ -1,6 +1,7 @@
 package go_ohm
 
 import (
+	"errors"
 	"fmt"
 )
 
@@ -18,6 +19,10 @@ type ErrorRedisCommandFailed struct {
 	error
 }
 
+func (e *ErrorRedisCommandFailed) Unwrap() error {
+	return errors.Unwrap(e.error)
+}
+
 func newErrorRedisCommandFailed(nam string, err error) *ErrorRedisCommandFailed {
 	return &ErrorRedisCommandFailed{
 		fmt.Errorf("execute redis command failed on object '%s': %w", nam, err),
@@ -48,8 +53,129 @@ type ErrorJsonFailed struct {
 	error
 }
 
+func (e *ErrorJsonFailed) Unwrap() error {
+	return errors.Unwrap(e.error)
+}
+
 func newErrorJsonFailed(nam string, err error) *ErrorJsonFailed {
 	return &ErrorJsonFailed{
 		fmt.Errorf("json marshal/unmarshal failed on object '%s': %w", nam, err),
 	}
 }
+
+type ErrorTransactionConflict struct {
+	error
+}
+
+func newErrorTransactionConflict(nam string) *ErrorTransactionConflict {
+	return &ErrorTransactionConflict{
+		fmt.Errorf("transaction aborted by watched keys on object '%s'", nam),
+	}
+}
+
+type ErrorVersionConflict struct {
+	error
+}
+
+func newErrorVersionConflict(nam string) *ErrorVersionConflict {
+	return &ErrorVersionConflict{
+		fmt.Errorf("version in redis mismatched on object '%s'", nam),
+	}
+}
+
+type ErrorObjectNotFound struct {
+	error
+}
+
+func newErrorObjectNotFound(nam string, key string) *ErrorObjectNotFound {
+	return &ErrorObjectNotFound{
+		fmt.Errorf("hash '%s' not found on object '%s'", key, nam),
+	}
+}
+
+type ErrorInvalidStructTag struct {
+	error
+}
+
+func (e *ErrorInvalidStructTag) Unwrap() error {
+	return errors.Unwrap(e.error)
+}
+
+func newErrorInvalidStructTag(nam string, tag string,
+	err error) *ErrorInvalidStructTag {
+	return &ErrorInvalidStructTag{
+		fmt.Errorf("invalid struct tag '%s' on object '%s': %w", tag, nam, err),
+	}
+}
+
+type ErrorFieldNotFound struct {
+	error
+}
+
+func newErrorFieldNotFound(nam string, fld string) *ErrorFieldNotFound {
+	return &ErrorFieldNotFound{
+		fmt.Errorf("field '%s' not found on object '%s'", fld, nam),
+	}
+}
+
+type ErrorBatchFailed struct {
+	error
+
+	// Errors of every element of the batch, nil for succeeded elements.
+	Errors []error
+}
+
+// newErrorBatchFailed returns nil if all elements succeeded.
+func newErrorBatchFailed(errs []error) error {
+	failed := 0
+	var firstErr error
+	for _, err := range errs {
+		if err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	if failed <= 0 {
+		return nil
+	}
+
+	return &ErrorBatchFailed{
+		fmt.Errorf("%d of %d objects failed, the first error: %w", failed,
+			len(errs), firstErr),
+		errs,
+	}
+}
+
+type ErrorCodecFailed struct {
+	error
+}
+
+func (e *ErrorCodecFailed) Unwrap() error {
+	return errors.Unwrap(e.error)
+}
+
+func newErrorCodecFailed(nam string, codec string,
+	err error) *ErrorCodecFailed {
+	return &ErrorCodecFailed{
+		fmt.Errorf("codec '%s' failed on object '%s': %w", codec, nam, err),
+	}
+}
+
+type ErrorInvalidValue struct {
+	error
+}
+
+func (e *ErrorInvalidValue) Unwrap() error {
+	return errors.Unwrap(e.error)
+}
+
+func newErrorInvalidValue(nam string, val string, typ string,
+	err error) *ErrorInvalidValue {
+	return &ErrorInvalidValue{
+		fmt.Errorf("invalid value '%s' of type '%s' on object '%s': %w", val,
+			typ, nam, err),
+	}
+}
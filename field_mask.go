@@ -0,0 +1,71 @@
+package go_ohm
+
+import (
+	"strings"
+)
+
+// fieldMask selects struct fields by go field names, and the fields of selected
+// fields by sub-masks. A nil mask selects all fields.
+type fieldMask map[string]fieldMask
+
+// newFieldMask creates mask from go field paths like "A.B", which selects field
+// "B" of field "A".
+func newFieldMask(paths []string) fieldMask {
+	mask := fieldMask{}
+	for _, p := range paths {
+		m := mask
+		parts := strings.Split(p, ".")
+		for i, part := range parts {
+			sub, ok := m[part]
+			if ok && sub == nil {
+				// the whole field is selected already.
+				break
+			} else if i == len(parts)-1 {
+				m[part] = nil
+				break
+			} else if !ok {
+				sub = fieldMask{}
+				m[part] = sub
+			}
+
+			m = sub
+		}
+	}
+
+	return mask
+}
+
+// selects reports whether the field is selected, and returns the mask of the
+// field's own fields.
+func (m fieldMask) selects(name string) (bool, fieldMask) {
+	if m == nil {
+		return true, nil
+	}
+
+	sub, ok := m[name]
+	return ok, sub
+}
+
+// promotes returns the mask of promoted struct `name`, whose fields are
+// selected by their own names, by paths of the struct's name like "A.B", or
+// all together by the struct's name.
+func (m fieldMask) promotes(name string) fieldMask {
+	sub, ok := m[name]
+	if m == nil || (ok && sub == nil) {
+		return nil
+	} else if !ok {
+		return m
+	}
+
+	mask := fieldMask{}
+	for k, v := range m {
+		mask[k] = v
+	}
+	for k, v := range sub {
+		if old, ok := mask[k]; !ok || (old != nil && v == nil) {
+			mask[k] = v
+		}
+	}
+
+	return mask
+}
@@ -5,10 +5,15 @@ go 1.17
 require (
 	github.com/alicebob/miniredis/v2 v2.15.1
 	github.com/davecgh/go-spew v1.1.0
-	github.com/gomodule/redigo v1.8.5
+	github.com/go-redis/redis/v8 v8.11.5
+	github.com/gomodule/redigo v1.8.9
+	github.com/vmihailenco/msgpack/v5 v5.3.5
 )
 
 require (
 	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
+	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
 	github.com/yuin/gopher-lua v0.0.0-20200816102855-ee81675732da // indirect
 )
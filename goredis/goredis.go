@@ -0,0 +1,161 @@
+// Package goredis adapts go-redis (https://github.com/go-redis/redis) clients
+// to `go_ohm.Conn`, so go-redis users can use go_ohm too.
+//
+// For instance:
+//
+//	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+//	conn := goredis.NewConn(ctx, client)
+//	err := go_ohm.Load(conn, "ns", &go_ohm.ObjectOptions{HashName: "a"}, &a)
+package goredis
+
+import (
+	"context"
+	"errors"
+
+	redisv8 "github.com/go-redis/redis/v8"
+	"github.com/gomodule/redigo/redis"
+)
+
+var errNoPendingReply = errors.New("goredis: no pending reply")
+
+// Conn implements `go_ohm.Conn` and `go_ohm.ConnWithContext` by go-redis
+// pipelines. Commands sent by Send() are buffered, and executed as a pipeline
+// by the following Receive(), so the pipeline is executed with the context
+// passed to ReceiveContext().
+//
+// A `*redis.Client` picks a connection from its pool for every pipeline, so the
+// connection state like WATCH does not survive across calls. Use a
+// `*redis.Conn` created by `Client.Conn()` if `ObjectOptions.Watch` is needed.
+// Transactions are not supported by `*redis.ClusterClient`.
+//
+// Like redigo's connection, Conn is not safe for concurrent use.
+type Conn struct {
+	ctx    context.Context
+	client redisv8.Cmdable
+
+	// commands sent but not executed.
+	pending [][]interface{}
+
+	// commands executed but replies not received.
+	executed []*redisv8.Cmd
+}
+
+// NewConn creates a Conn executes commands by `client`. The context `ctx` is
+// used by the methods without context argument.
+func NewConn(ctx context.Context, client redisv8.Cmdable) *Conn {
+	return &Conn{ctx: ctx, client: client}
+}
+
+// Do sends a command and receives replies of all pending commands, and then
+// returns the last reply. If `commandName` is "", it only executes pending
+// commands and receives their replies.
+func (c *Conn) Do(commandName string, args ...interface{}) (interface{},
+	error) {
+	return c.DoContext(c.ctx, commandName, args...)
+}
+
+// DoContext is like Do(), but executes commands with context `ctx`.
+func (c *Conn) DoContext(ctx context.Context, commandName string,
+	args ...interface{}) (interface{}, error) {
+	if commandName != "" {
+		err := c.Send(commandName, args...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.execute(ctx)
+
+	var reply interface{}
+	var firstErr error
+	for len(c.executed) > 0 {
+		rep, err := c.ReceiveContext(ctx)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		reply = rep
+	}
+
+	return reply, firstErr
+}
+
+// Send buffers the command until it is executed.
+func (c *Conn) Send(commandName string, args ...interface{}) error {
+	cmd := make([]interface{}, 0, len(args)+1)
+	cmd = append(cmd, commandName)
+	cmd = append(cmd, args...)
+	c.pending = append(c.pending, cmd)
+	return nil
+}
+
+// Flush does nothing, since buffered commands are executed by Receive().
+func (c *Conn) Flush() error {
+	return nil
+}
+
+// Receive returns the reply of the earliest sent command, converted to
+// redigo's format. If all executed commands' replies were received, it
+// executes the buffered commands as a pipeline first.
+func (c *Conn) Receive() (interface{}, error) {
+	return c.ReceiveContext(c.ctx)
+}
+
+// ReceiveContext is like Receive(), but executes commands with context `ctx`.
+func (c *Conn) ReceiveContext(ctx context.Context) (interface{}, error) {
+	if len(c.executed) <= 0 {
+		c.execute(ctx)
+		if len(c.executed) <= 0 {
+			return nil, errNoPendingReply
+		}
+	}
+
+	cmd := c.executed[0]
+	c.executed = c.executed[1:]
+
+	rep, err := cmd.Result()
+	if err == redisv8.Nil {
+		return nil, nil
+	} else if err != nil {
+		if e, ok := err.(redisv8.Error); ok {
+			return nil, redis.Error(e.Error())
+		}
+		return nil, err
+	}
+
+	return convertReply(rep), nil
+}
+
+// execute buffered commands as a pipeline. Errors of commands are returned by
+// Receive().
+func (c *Conn) execute(ctx context.Context) {
+	if len(c.pending) <= 0 {
+		return
+	}
+
+	pipe := c.client.Pipeline()
+	for _, args := range c.pending {
+		c.executed = append(c.executed, pipe.Do(ctx, args...))
+	}
+	c.pending = nil
+
+	// errors are stored in commands too.
+	_, _ = pipe.Exec(ctx)
+}
+
+// convertReply converts go-redis's reply to redigo's format.
+func convertReply(rep interface{}) interface{} {
+	switch r := rep.(type) {
+	case string:
+		return []byte(r)
+	case []interface{}:
+		ret := make([]interface{}, len(r))
+		for i, v := range r {
+			ret[i] = convertReply(v)
+		}
+		return ret
+	case redisv8.Error:
+		return redis.Error(r.Error())
+	default:
+		return r
+	}
+}
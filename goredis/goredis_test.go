@@ -0,0 +1,114 @@
+package goredis
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/abadcafe/go_ohm"
+	"github.com/alicebob/miniredis/v2"
+	redisv8 "github.com/go-redis/redis/v8"
+)
+
+func TestConn(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	ctx := context.Background()
+	client := redisv8.NewClient(&redisv8.Options{Addr: redisServer.Addr()})
+	defer client.Close()
+
+	type child struct {
+		I int
+	}
+
+	type parent struct {
+		V     int `go_ohm:"version"`
+		B     []byte
+		M     map[string]int
+		Ref   string
+		Child *child         `go_ohm:"reference=Ref,non_json"`
+		Map   map[int]string `go_ohm:"hash_name=m,non_json"`
+	}
+
+	opts := &go_ohm.ObjectOptions{HashName: "p1", Atomic: true, Watch: true}
+	p1 := &parent{
+		B:     []byte("b"),
+		M:     map[string]int{"a": 1},
+		Ref:   "c1",
+		Child: &child{I: 1},
+		Map:   map[int]string{1: "a"},
+	}
+
+	t.Run("test Save() and Load() by client", func(t *testing.T) {
+		c := NewConn(ctx, client)
+		err := go_ohm.Save(c, "test", opts, p1)
+		if err != nil {
+			t.Error(err)
+		}
+
+		p2 := &parent{}
+		err = go_ohm.Load(c, "test", &go_ohm.ObjectOptions{HashName: "p1"}, p2)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(p1, p2) {
+			t.Error("loaded data not equal saved data")
+		}
+
+		var e *go_ohm.ErrorObjectNotFound
+		err = go_ohm.Load(c, "test", &go_ohm.ObjectOptions{HashName: "p2"},
+			&parent{})
+		if !errors.As(err, &e) {
+			t.Error(err)
+		}
+	})
+
+	t.Run("test watched Save() by connection", func(t *testing.T) {
+		conn := client.Conn(ctx)
+		defer conn.Close()
+		c := NewConn(ctx, conn)
+
+		p2 := &parent{}
+		err := go_ohm.Load(c, "test", opts, p2)
+		if err != nil {
+			t.Error(err)
+		}
+
+		client.HSet(ctx, "test#child#c1", "I", 2)
+
+		var e *go_ohm.ErrorTransactionConflict
+		err = go_ohm.Save(c, "test", opts, p2)
+		if !errors.As(err, &e) {
+			t.Error(err)
+		}
+	})
+
+	t.Run("test LoadContext() canceled", func(t *testing.T) {
+		c := NewConn(ctx, client)
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		err := go_ohm.LoadContext(cctx, c, "test", opts, &parent{})
+		if !errors.Is(err, context.Canceled) {
+			t.Error(err)
+		}
+	})
+
+	t.Run("test Do()", func(t *testing.T) {
+		c := NewConn(ctx, client)
+		_ = c.Send("SET", "k", "v")
+		rep, err := c.Do("GET", "k")
+		if err != nil || string(rep.([]byte)) != "v" {
+			t.Error(rep, err)
+		}
+
+		rep, err = c.Do("GET", "k2")
+		if err != nil || rep != nil {
+			t.Error(rep, err)
+		}
+	})
+}
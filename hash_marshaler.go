@@ -0,0 +1,175 @@
+package go_ohm
+
+import (
+	"encoding"
+	"strconv"
+)
+
+// HashMarshaler is implemented by structs which generate their own redis hash
+// field value pairs, EX, by code generated by command go_ohm. Save() uses it
+// instead of reflection if the struct is addressable and all fields are saved.
+//
+// The returned pairs must be same as the reflective path's, which are plain
+// fields' hash fields and values, in the order of struct fields.
+type HashMarshaler interface {
+	HashFields() ([]interface{}, error)
+}
+
+// HashUnmarshaler is implemented by structs which render their own plain fields
+// from redis hash fields, EX, by code generated by command go_ohm. Load() uses
+// it instead of reflection if the struct is addressable and all fields are
+// loaded. `fields` contains the existing hash fields only.
+//
+// Both of them are not used if the struct inherits a codec other than the
+// default, see `ObjectOptions.Codec`.
+type HashUnmarshaler interface {
+	FromHash(fields map[string][]byte) error
+}
+
+// ParseStructTag parses struct tag `tag` into `opts`, and reports whether the
+// field is ignored. It is used by code generators.
+func ParseStructTag(tag string, opts *ObjectOptions) (bool, error) {
+	return parseObjectOptions(tag, opts)
+}
+
+// ParseHashInt parses the integer value of field `name`, which type is `typ`,
+// like Load() does. `bitSize` is same as strconv.ParseInt()'s, and out of range
+// values are invalid.
+func ParseHashInt(name string, b []byte, typ string,
+	bitSize int) (int64, error) {
+	i, err := strconv.ParseInt(string(b), 10, bitSize)
+	if err != nil {
+		return 0, newErrorInvalidValue(name, string(b), typ, err)
+	}
+	return i, nil
+}
+
+// ParseHashUint parses the unsigned integer value of field `name`, which type
+// is `typ`, like Load() does. See ParseHashInt().
+func ParseHashUint(name string, b []byte, typ string,
+	bitSize int) (uint64, error) {
+	u, err := strconv.ParseUint(string(b), 10, bitSize)
+	if err != nil {
+		return 0, newErrorInvalidValue(name, string(b), typ, err)
+	}
+	return u, nil
+}
+
+// ParseHashBool parses the boolean value of field `name`, which type is `typ`,
+// like Load() does.
+func ParseHashBool(name string, b []byte, typ string) (bool, error) {
+	v, err := strconv.ParseBool(string(b))
+	if err != nil {
+		return false, newErrorInvalidValue(name, string(b), typ, err)
+	}
+	return v, nil
+}
+
+// ParseHashFloat parses the float value of field `name`, which type is `typ`,
+// like Load() does. See ParseHashInt().
+func ParseHashFloat(name string, b []byte, typ string,
+	bitSize int) (float64, error) {
+	f, err := strconv.ParseFloat(string(b), bitSize)
+	if err != nil {
+		return 0, newErrorInvalidValue(name, string(b), typ, err)
+	}
+	return f, nil
+}
+
+// ParseHashComplex parses the complex value of field `name`, which type is
+// `typ`, like Load() does. See ParseHashInt().
+func ParseHashComplex(name string, b []byte, typ string,
+	bitSize int) (complex128, error) {
+	c, err := strconv.ParseComplex(string(b), bitSize)
+	if err != nil {
+		return 0, newErrorInvalidValue(name, string(b), typ, err)
+	}
+	return c, nil
+}
+
+// MarshalHashValue encodes field `name`'s value by codec `codec` like Save()
+// does, "" means the default codec. `v` should be a pointer to the value.
+func MarshalHashValue(name string, codec string, v interface{}) (string, error) {
+	c, err := getCodec(name, codec)
+	if err != nil {
+		return "", err
+	}
+
+	bs, err := c.Marshal(v)
+	if err != nil {
+		return "", newErrorValueCodecFailed(name, codec, err)
+	}
+	return string(bs), nil
+}
+
+// UnmarshalHashValue decodes field `name`'s value by codec `codec` like Load()
+// does, "" means the default codec. `v` should be a pointer to the value.
+func UnmarshalHashValue(name string, codec string, b []byte,
+	v interface{}) error {
+	c, err := getCodec(name, codec)
+	if err != nil {
+		return err
+	}
+
+	err = c.Unmarshal(b, v)
+	if err != nil {
+		return newErrorValueCodecFailed(name, codec, err)
+	}
+	return nil
+}
+
+// MarshalHashText encodes field `name`'s value by its `encoding.TextMarshaler`,
+// or `encoding.BinaryMarshaler` like Save() does. `v` should be a pointer to
+// the value.
+func MarshalHashText(name string, v interface{}) (string, error) {
+	var bs []byte
+	var err error
+	if m, ok := v.(encoding.TextMarshaler); ok && isTextUnmarshaler(v) {
+		bs, err = m.MarshalText()
+		if err != nil {
+			return "", newErrorCodecFailed(name, "text", err)
+		}
+	} else if m, ok := v.(encoding.BinaryMarshaler); ok {
+		bs, err = m.MarshalBinary()
+		if err != nil {
+			return "", newErrorCodecFailed(name, "binary", err)
+		}
+	} else {
+		return "", newErrorUnsupportedObjectType(name)
+	}
+
+	return string(bs), nil
+}
+
+// UnmarshalHashText decodes field `name`'s value by its
+// `encoding.TextUnmarshaler`, or `encoding.BinaryUnmarshaler` like Load()
+// does. `v` should be a pointer to the value.
+func UnmarshalHashText(name string, b []byte, v interface{}) error {
+	if u, ok := v.(encoding.TextUnmarshaler); ok && isTextMarshaler(v) {
+		err := u.UnmarshalText(b)
+		if err != nil {
+			return newErrorCodecFailed(name, "text", err)
+		}
+	} else if u, ok := v.(encoding.BinaryUnmarshaler); ok {
+		err := u.UnmarshalBinary(b)
+		if err != nil {
+			return newErrorCodecFailed(name, "binary", err)
+		}
+	} else {
+		return newErrorUnsupportedObjectType(name)
+	}
+
+	return nil
+}
+
+// text methods are used only if both of them are implemented, see
+// isMarshalerType().
+func isTextMarshaler(v interface{}) bool {
+	_, ok := v.(encoding.TextMarshaler)
+	return ok
+}
+
+func isTextUnmarshaler(v interface{}) bool {
+	_, ok := v.(encoding.TextUnmarshaler)
+	return ok
+}
@@ -0,0 +1,66 @@
+// Package example demonstrates code generated by command go_ohm, and tests the
+// generated code stores the same redis layout as the reflective path.
+package example
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+//go:generate go run ../../cmd/go_ohm -type=User
+
+type Level int
+
+// String makes sure generated code does not format by fmt.
+func (l Level) String() string {
+	return "level"
+}
+
+// Color is stored by its text methods.
+type Color int
+
+func (c Color) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("color-%d", int(c))), nil
+}
+
+func (c *Color) UnmarshalText(b []byte) error {
+	_, err := fmt.Sscanf(string(b), "color-%d", (*int)(c))
+	return err
+}
+
+type Profile struct {
+	Bio  string
+	Tags []string
+}
+
+type Address struct {
+	City string
+}
+
+type User struct {
+	Version int64  `go_ohm:"version"`
+	Name    string `go_ohm:"hash_field=name"`
+	Age     uint8
+	Score   float32
+	Ratio   float64
+	C       complex64
+	Active  bool
+	Data    []byte
+	Level   Level
+	Nick    *string
+	Timeout time.Duration
+	Tags    []string
+	Profile Profile
+	Extra   *Profile
+	Friends map[string]int
+	Blob    Profile       `go_ohm:"codec=gob"`
+	Color   Color         `go_ohm:"marshaler"`
+	IP      net.IP        `go_ohm:"marshaler"`
+	Seen    *time.Time    `go_ohm:"marshaler"`
+	Created time.Time     `go_ohm:"time_format=unix_ms"`
+	Expiry  time.Duration `go_ohm:"time_format=string"`
+	Ignored int           `go_ohm:"-"`
+	hidden  int
+	Address *Address `go_ohm:"hash_name=addr,non_json"`
+}
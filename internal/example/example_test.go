@@ -0,0 +1,178 @@
+package example
+
+import (
+	"io/ioutil"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/abadcafe/go_ohm"
+	"github.com/abadcafe/go_ohm/internal/gen"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gomodule/redigo/redis"
+)
+
+// reflectUser is same as User without generated methods.
+type reflectUser struct {
+	Version int64  `go_ohm:"version"`
+	Name    string `go_ohm:"hash_field=name"`
+	Age     uint8
+	Score   float32
+	Ratio   float64
+	C       complex64
+	Active  bool
+	Data    []byte
+	Level   Level
+	Nick    *string
+	Timeout time.Duration
+	Tags    []string
+	Profile Profile
+	Extra   *Profile
+	Friends map[string]int
+	Blob    Profile       `go_ohm:"codec=gob"`
+	Color   Color         `go_ohm:"marshaler"`
+	IP      net.IP        `go_ohm:"marshaler"`
+	Seen    *time.Time    `go_ohm:"marshaler"`
+	Created time.Time     `go_ohm:"time_format=unix_ms"`
+	Expiry  time.Duration `go_ohm:"time_format=string"`
+	Ignored int           `go_ohm:"-"`
+	hidden  int
+	Address *Address `go_ohm:"hash_name=addr,non_json"`
+}
+
+func TestGenerated(t *testing.T) {
+	src, err := gen.Generate([]string{"."}, []string{"User"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := ioutil.ReadFile("user_ohm.go")
+	if err != nil {
+		t.Fatal(err)
+	} else if string(bs) != string(src) {
+		t.Error("user_ohm.go is stale, run go generate")
+	}
+}
+
+func TestLayout(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	c, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+	defer c.Close()
+
+	nick := "n"
+	seen := time.Date(2021, 1, 2, 3, 4, 5, 6, time.UTC)
+	u1 := &User{
+		Name:    "a",
+		Age:     200,
+		Score:   1.1,
+		Ratio:   -2.5e30,
+		C:       complex(1, -2),
+		Active:  true,
+		Data:    []byte("data"),
+		Level:   3,
+		Nick:    &nick,
+		Timeout: time.Minute,
+		Tags:    []string{"x", "y"},
+		Profile: Profile{Bio: "b", Tags: []string{"z"}},
+		Friends: map[string]int{"f": 1},
+		Blob:    Profile{Bio: "gob"},
+		Color:   2,
+		IP:      net.IPv4(1, 2, 3, 4),
+		Seen:    &seen,
+		Created: time.UnixMilli(1600000000123).UTC(),
+		Expiry:  90 * time.Second,
+		Address: &Address{City: "c"},
+	}
+	r := reflectUser(*u1)
+	r1 := &r
+
+	opts := &go_ohm.ObjectOptions{HashName: "u1", HashPrefix: "user"}
+	err = go_ohm.Save(c, "gen", opts, u1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = go_ohm.Save(c, "ref", opts, r1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"user#u1", "Address#addr"} {
+		gen, err := redis.StringMap(c.Do("HGETALL", "gen#"+key))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ref, err := redis.StringMap(c.Do("HGETALL", "ref#"+key))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(gen) <= 0 || !reflect.DeepEqual(gen, ref) {
+			t.Errorf("layout of %s mismatched: %v, %v", key, gen, ref)
+		}
+	}
+
+	// load each other's hashes.
+	u2 := &User{}
+	err = go_ohm.Load(c, "ref", opts, u2)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(u1, u2) {
+		t.Errorf("%+v != %+v", u1, u2)
+	}
+
+	r2 := &reflectUser{}
+	err = go_ohm.Load(c, "gen", opts, r2)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(r1, r2) {
+		t.Errorf("%+v != %+v", r1, r2)
+	}
+
+	t.Run("test inherited codec", func(t *testing.T) {
+		opts := &go_ohm.ObjectOptions{HashName: "u2", HashPrefix: "user",
+			Codec: "gob"}
+		u := *u1
+		u.Version = 0
+		r := reflectUser(u)
+		err := go_ohm.Save(c, "gen", opts, &u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = go_ohm.Save(c, "ref", opts, &r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gen, _ := redis.StringMap(c.Do("HGETALL", "gen#user#u2"))
+		ref, _ := redis.StringMap(c.Do("HGETALL", "ref#user#u2"))
+		if len(gen) <= 0 || !reflect.DeepEqual(gen, ref) {
+			t.Errorf("layout mismatched: %v, %v", gen, ref)
+		}
+	})
+
+	t.Run("test version conflict", func(t *testing.T) {
+		u3 := &User{}
+		err := go_ohm.Load(c, "gen", opts, u3)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		u3.Version = 0
+		err = go_ohm.Save(c, "gen", opts, u3)
+		if _, ok := err.(*go_ohm.ErrorVersionConflict); !ok {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,224 @@
+// Code generated by go_ohm; DO NOT EDIT.
+
+package example
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/abadcafe/go_ohm"
+)
+
+// HashFields implements go_ohm.HashMarshaler.
+func (v *User) HashFields() ([]interface{}, error) {
+	args := make([]interface{}, 0, 42)
+	args = append(args, "Version", strconv.FormatInt(int64(v.Version), 10))
+	args = append(args, "name", string(v.Name))
+	args = append(args, "Age", strconv.FormatUint(uint64(v.Age), 10))
+	args = append(args, "Score", strconv.FormatFloat(float64(v.Score), 'g', -1, 32))
+	args = append(args, "Ratio", strconv.FormatFloat(float64(v.Ratio), 'g', -1, 64))
+	args = append(args, "C", strconv.FormatComplex(complex128(v.C), 'g', -1, 64))
+	args = append(args, "Active", strconv.FormatBool(bool(v.Active)))
+	args = append(args, "Data", string(v.Data))
+	args = append(args, "Level", strconv.FormatInt(int64(v.Level), 10))
+	if v.Nick == nil {
+		args = append(args, "Nick", "")
+	} else {
+		args = append(args, "Nick", string(*v.Nick))
+	}
+	if s, err := go_ohm.FormatHashDuration("Timeout", "", v.Timeout); err != nil {
+		return nil, err
+	} else {
+		args = append(args, "Timeout", s)
+	}
+	if s, err := go_ohm.MarshalHashValue("Tags", "", &v.Tags); err != nil {
+		return nil, err
+	} else {
+		args = append(args, "Tags", s)
+	}
+	if s, err := go_ohm.MarshalHashValue("Profile", "", &v.Profile); err != nil {
+		return nil, err
+	} else {
+		args = append(args, "Profile", s)
+	}
+	if v.Extra == nil {
+		args = append(args, "Extra", "")
+	} else if s, err := go_ohm.MarshalHashValue("Extra", "", v.Extra); err != nil {
+		return nil, err
+	} else {
+		args = append(args, "Extra", s)
+	}
+	if s, err := go_ohm.MarshalHashValue("Friends", "", &v.Friends); err != nil {
+		return nil, err
+	} else {
+		args = append(args, "Friends", s)
+	}
+	if s, err := go_ohm.MarshalHashValue("Blob", "gob", &v.Blob); err != nil {
+		return nil, err
+	} else {
+		args = append(args, "Blob", s)
+	}
+	if s, err := go_ohm.MarshalHashText("Color", &v.Color); err != nil {
+		return nil, err
+	} else {
+		args = append(args, "Color", s)
+	}
+	if s, err := go_ohm.MarshalHashText("IP", &v.IP); err != nil {
+		return nil, err
+	} else {
+		args = append(args, "IP", s)
+	}
+	if v.Seen == nil {
+		args = append(args, "Seen", "")
+	} else if s, err := go_ohm.FormatHashTime("Seen", "", *v.Seen); err != nil {
+		return nil, err
+	} else {
+		args = append(args, "Seen", s)
+	}
+	if s, err := go_ohm.FormatHashTime("Created", "unix_ms", v.Created); err != nil {
+		return nil, err
+	} else {
+		args = append(args, "Created", s)
+	}
+	if s, err := go_ohm.FormatHashDuration("Expiry", "string", v.Expiry); err != nil {
+		return nil, err
+	} else {
+		args = append(args, "Expiry", s)
+	}
+	return args, nil
+}
+
+// FromHash implements go_ohm.HashUnmarshaler.
+func (v *User) FromHash(fields map[string][]byte) error {
+	if b := fields["Version"]; len(b) > 0 {
+		p, err := go_ohm.ParseHashInt("Version", b, "int64", 64)
+		if err != nil {
+			return err
+		}
+		v.Version = int64(p)
+	}
+	if b := fields["name"]; len(b) > 0 {
+		v.Name = string(b)
+	}
+	if b := fields["Age"]; len(b) > 0 {
+		p, err := go_ohm.ParseHashUint("Age", b, "uint8", 8)
+		if err != nil {
+			return err
+		}
+		v.Age = uint8(p)
+	}
+	if b := fields["Score"]; len(b) > 0 {
+		p, err := go_ohm.ParseHashFloat("Score", b, "float32", 32)
+		if err != nil {
+			return err
+		}
+		v.Score = float32(p)
+	}
+	if b := fields["Ratio"]; len(b) > 0 {
+		p, err := go_ohm.ParseHashFloat("Ratio", b, "float64", 64)
+		if err != nil {
+			return err
+		}
+		v.Ratio = float64(p)
+	}
+	if b := fields["C"]; len(b) > 0 {
+		p, err := go_ohm.ParseHashComplex("C", b, "complex64", 64)
+		if err != nil {
+			return err
+		}
+		v.C = complex64(p)
+	}
+	if b := fields["Active"]; len(b) > 0 {
+		p, err := go_ohm.ParseHashBool("Active", b, "bool")
+		if err != nil {
+			return err
+		}
+		v.Active = bool(p)
+	}
+	if b := fields["Data"]; len(b) > 0 {
+		v.Data = []byte(b)
+	}
+	if b := fields["Level"]; len(b) > 0 {
+		p, err := go_ohm.ParseHashInt("Level", b, "example.Level", 0)
+		if err != nil {
+			return err
+		}
+		v.Level = Level(p)
+	}
+	if b := fields["Nick"]; len(b) > 0 {
+		if v.Nick == nil {
+			v.Nick = new(string)
+		}
+		*v.Nick = string(b)
+	}
+	if b := fields["Timeout"]; len(b) > 0 {
+		p, err := go_ohm.ParseHashDuration("Timeout", "", b)
+		if err != nil {
+			return err
+		}
+		v.Timeout = time.Duration(p)
+	}
+	if b := fields["Tags"]; len(b) > 0 {
+		if err := go_ohm.UnmarshalHashValue("Tags", "", b, &v.Tags); err != nil {
+			return err
+		}
+	}
+	if b := fields["Profile"]; len(b) > 0 {
+		if err := go_ohm.UnmarshalHashValue("Profile", "", b, &v.Profile); err != nil {
+			return err
+		}
+	}
+	if b := fields["Extra"]; len(b) > 0 {
+		if v.Extra == nil {
+			v.Extra = new(Profile)
+		}
+		if err := go_ohm.UnmarshalHashValue("Extra", "", b, v.Extra); err != nil {
+			return err
+		}
+	}
+	if b := fields["Friends"]; len(b) > 0 {
+		if err := go_ohm.UnmarshalHashValue("Friends", "", b, &v.Friends); err != nil {
+			return err
+		}
+	}
+	if b := fields["Blob"]; len(b) > 0 {
+		if err := go_ohm.UnmarshalHashValue("Blob", "gob", b, &v.Blob); err != nil {
+			return err
+		}
+	}
+	if b := fields["Color"]; len(b) > 0 {
+		if err := go_ohm.UnmarshalHashText("Color", b, &v.Color); err != nil {
+			return err
+		}
+	}
+	if b := fields["IP"]; len(b) > 0 {
+		if err := go_ohm.UnmarshalHashText("IP", b, &v.IP); err != nil {
+			return err
+		}
+	}
+	if b := fields["Seen"]; len(b) > 0 {
+		if v.Seen == nil {
+			v.Seen = new(time.Time)
+		}
+		p, err := go_ohm.ParseHashTime("Seen", "", b)
+		if err != nil {
+			return err
+		}
+		*v.Seen = p
+	}
+	if b := fields["Created"]; len(b) > 0 {
+		p, err := go_ohm.ParseHashTime("Created", "unix_ms", b)
+		if err != nil {
+			return err
+		}
+		v.Created = p
+	}
+	if b := fields["Expiry"]; len(b) > 0 {
+		p, err := go_ohm.ParseHashDuration("Expiry", "string", b)
+		if err != nil {
+			return err
+		}
+		v.Expiry = time.Duration(p)
+	}
+	return nil
+}
@@ -0,0 +1,616 @@
+// Package gen generates `go_ohm.HashMarshaler` and `go_ohm.HashUnmarshaler`
+// implementations for structs, see command go_ohm.
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/abadcafe/go_ohm"
+)
+
+const (
+	ohmPath     = "github.com/abadcafe/go_ohm"
+	tagKey      = "go_ohm"
+	generatedBy = "// Code generated by go_ohm; DO NOT EDIT."
+)
+
+// field is a plain field of the struct, which is stored as a hash field.
+type field struct {
+	name      string
+	hashField string
+	json      bool
+	codec     string
+
+	// stored by methods of encoding.TextMarshaler or BinaryMarshaler.
+	text bool
+
+	// "Time" or "Duration" for fields of package time's types, which are
+	// stored by `timeFormat`.
+	timeType   string
+	timeFormat string
+
+	// the field is a pointer, and typ is the pointed type.
+	ptr bool
+	typ types.Type
+}
+
+type generator struct {
+	pkg     *types.Package
+	imports map[string]string
+	buf     bytes.Buffer
+}
+
+// Generate generates methods for struct types `typeNames` in the package, which
+// is a directory if `paths` has only one element and it is a directory, or go
+// files `paths`. Files generated by go_ohm are skipped, so stale methods do not
+// break type checking.
+func Generate(paths []string, typeNames []string) ([]byte, error) {
+	fset := token.NewFileSet()
+	files, err := parseFiles(fset, paths)
+	if err != nil {
+		return nil, err
+	} else if len(files) <= 0 {
+		return nil, fmt.Errorf("no go files found in %v", paths)
+	}
+
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := conf.Check(files[0].Name.Name, fset, files, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{pkg: pkg, imports: map[string]string{}}
+	for _, name := range typeNames {
+		err := g.generateType(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return g.output()
+}
+
+func parseFiles(fset *token.FileSet, paths []string) ([]*ast.File, error) {
+	var names []string
+	if len(paths) == 1 && !strings.HasSuffix(paths[0], ".go") {
+		bp, err := build.ImportDir(paths[0], 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range bp.GoFiles {
+			names = append(names, filepath.Join(paths[0], f))
+		}
+	} else {
+		names = paths
+	}
+
+	var files []*ast.File
+	for _, name := range names {
+		f, err := parser.ParseFile(fset, name, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+
+		if isGenerated(f) {
+			continue
+		}
+		files = append(files, f)
+	}
+
+	return files, nil
+}
+
+func isGenerated(f *ast.File) bool {
+	for _, c := range f.Comments {
+		if c.Pos() >= f.Package {
+			break
+		}
+
+		for _, l := range c.List {
+			if l.Text == generatedBy {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// qualifier records imported packages of types used by generated code.
+func (g *generator) qualifier(pkg *types.Package) string {
+	if pkg == g.pkg {
+		return ""
+	}
+
+	g.imports[pkg.Path()] = pkg.Name()
+	return pkg.Name()
+}
+
+func (g *generator) typeString(typ types.Type) string {
+	return types.TypeString(typ, g.qualifier)
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) generateType(name string) error {
+	obj := g.pkg.Scope().Lookup(name)
+	if obj == nil {
+		return fmt.Errorf("type %s not found", name)
+	}
+
+	tn, ok := obj.(*types.TypeName)
+	if !ok {
+		return fmt.Errorf("%s is not a type", name)
+	}
+
+	st, ok := tn.Type().Underlying().(*types.Struct)
+	if !ok {
+		return fmt.Errorf("type %s is not a struct", name)
+	}
+
+	fields, err := parseFields(st)
+	if err != nil {
+		return fmt.Errorf("type %s: %w", name, err)
+	}
+
+	g.generateHashFields(name, fields)
+	g.generateFromHash(name, fields)
+	return nil
+}
+
+// parseFields returns plain fields of the struct like go_ohm's reflective path
+// does. Compound fields are stored in other hashes, so they are skipped.
+func parseFields(st *types.Struct) ([]*field, error) {
+	var fields []*field
+
+	for i := 0; i < st.NumFields(); i++ {
+		v := st.Field(i)
+		if !v.Exported() && !v.Embedded() {
+			continue
+		}
+
+		tag := reflect.StructTag(st.Tag(i)).Get(tagKey)
+		jsonOpts := &go_ohm.ObjectOptions{Json: true}
+		nonJsonOpts := &go_ohm.ObjectOptions{}
+		ignore, err := go_ohm.ParseStructTag(tag, jsonOpts)
+		if err == nil {
+			_, err = go_ohm.ParseStructTag(tag, nonJsonOpts)
+		}
+		if ignore {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid struct tag '%s' on field %s: %w",
+				tag, v.Name(), err)
+		}
+
+		f := &field{name: v.Name(), typ: v.Type()}
+		for {
+			p, ok := f.typ.Underlying().(*types.Pointer)
+			if !ok {
+				break
+			} else if f.ptr {
+				return nil, fmt.Errorf("field %s: multiple level pointers "+
+					"are unsupported", f.name)
+			}
+
+			f.ptr = true
+			f.typ = p.Elem()
+		}
+
+		opts := nonJsonOpts
+		if !isNative(f.typ, nonJsonOpts) && !v.Embedded() {
+			opts = jsonOpts
+		}
+
+		_, isMap := f.typ.Underlying().(*types.Map)
+		if opts.ScanCount > 0 && !isMap {
+			return nil, fmt.Errorf("invalid struct tag '%s' on field %s: "+
+				"scan_count is for maps only", tag, f.name)
+		} else if opts.Marshaler && !isMap && !isMarshaler(f.typ) {
+			return nil, fmt.Errorf("field %s: type %s is unsupported by "+
+				"marshaler", f.name, f.typ)
+		} else if !isMap && isNative(f.typ, opts) && !isPrimitive(f.typ) &&
+			(opts.Json || opts.HashName != "" || opts.Reference != "") {
+			return nil, fmt.Errorf("invalid struct tag '%s' on field %s: "+
+				"conflicted with json, hash_name and reference", tag, f.name)
+		}
+
+		switch f.typ.Underlying().(type) {
+		case *types.Interface, *types.Chan, *types.Signature:
+			return nil, fmt.Errorf("field %s: type %s is unsupported", f.name,
+				f.typ)
+		case *types.Struct, *types.Map:
+			if !opts.Json && !isNative(f.typ, opts) {
+				if v.Embedded() && opts.Reference == "" && opts.HashName == "" {
+					return nil, fmt.Errorf("field %s: promoted fields are "+
+						"unsupported", f.name)
+				}
+
+				// stored in its own hash.
+				continue
+			}
+		}
+
+		if v.Embedded() {
+			return nil, fmt.Errorf("field %s: embedded fields are unsupported",
+				f.name)
+		} else if !opts.Json && !isNative(f.typ, opts) {
+			return nil, fmt.Errorf("field %s: type %s is unsupported without "+
+				"json", f.name, f.typ)
+		}
+
+		f.json = opts.Json
+		f.codec = opts.Codec
+		if !f.json {
+			f.timeType = timeTypeName(f.typ)
+			f.timeFormat = opts.TimeFormat
+			if !isTimeFormatSupported(f.timeType, f.timeFormat) {
+				return nil, fmt.Errorf("field %s: time format %s is "+
+					"unsupported by type %s", f.name, f.timeFormat, f.typ)
+			}
+		}
+		f.text = !f.json && f.timeType == "" && opts.Marshaler &&
+			isMarshaler(f.typ)
+		f.hashField = f.name
+		if opts.HashField != "" {
+			f.hashField = opts.HashField
+		}
+		fields = append(fields, f)
+	}
+
+	return fields, nil
+}
+
+// isNative is same as go_ohm's isNativeType().
+func isNative(typ types.Type, opts *go_ohm.ObjectOptions) bool {
+	return isPrimitive(typ) || (opts.Marshaler && isMarshaler(typ)) ||
+		(timeTypeName(typ) == "Time" && opts.TimeFormat != "")
+}
+
+// isPrimitive is same as go_ohm's isPrimitiveType().
+func isPrimitive(typ types.Type) bool {
+	switch t := typ.Underlying().(type) {
+	case *types.Basic:
+		return t.Info()&(types.IsBoolean|types.IsNumeric|types.IsString) != 0
+	case *types.Slice:
+		return isByte(t.Elem())
+	}
+
+	return false
+}
+
+// isMarshaler is same as go_ohm's isMarshalerType().
+func isMarshaler(typ types.Type) bool {
+	return (hasMethod(typ, "MarshalText") && hasMethod(typ, "UnmarshalText")) ||
+		(hasMethod(typ, "MarshalBinary") && hasMethod(typ, "UnmarshalBinary"))
+}
+
+// hasMethod reports whether the pointer to `typ` has method `name`.
+func hasMethod(typ types.Type, name string) bool {
+	obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(typ), true, nil,
+		name)
+	_, ok := obj.(*types.Func)
+	return ok
+}
+
+// timeTypeName returns "Time" or "Duration" for `time.Time` and
+// `time.Duration`, otherwise "".
+func timeTypeName(typ types.Type) string {
+	n, ok := typ.(*types.Named)
+	if !ok || n.Obj().Pkg() == nil || n.Obj().Pkg().Path() != "time" {
+		return ""
+	}
+
+	switch name := n.Obj().Name(); name {
+	case "Time", "Duration":
+		return name
+	}
+
+	return ""
+}
+
+// isTimeFormatSupported is same as go_ohm's isTimeFormatSupported().
+func isTimeFormatSupported(timeType string, format string) bool {
+	switch format {
+	case "":
+		return true
+	case "rfc3339nano", "unix", "unix_ms":
+		return timeType == "Time"
+	case "ns", "ms", "s", "string":
+		return timeType == "Duration"
+	}
+
+	return false
+}
+
+func isByte(typ types.Type) bool {
+	return types.Identical(typ, types.Typ[types.Byte])
+}
+
+// marshalCall returns the go_ohm function call formats field `f`, which value
+// is `x`, or "" if the field is formatted by kind.
+func (g *generator) marshalCall(f *field, x string) string {
+	p, val := "&"+x, x
+	if f.ptr {
+		p, val = x, "*"+x
+	}
+
+	switch {
+	case f.json:
+		return fmt.Sprintf("go_ohm.MarshalHashValue(%q, %q, %s)", f.name,
+			f.codec, p)
+	case f.timeType == "Time":
+		return fmt.Sprintf("go_ohm.FormatHashTime(%q, %q, %s)", f.name,
+			f.timeFormat, val)
+	case f.timeType == "Duration":
+		return fmt.Sprintf("go_ohm.FormatHashDuration(%q, %q, %s)", f.name,
+			f.timeFormat, val)
+	case f.text:
+		return fmt.Sprintf("go_ohm.MarshalHashText(%q, %s)", f.name, p)
+	}
+
+	return ""
+}
+
+func (g *generator) generateHashFields(name string, fields []*field) {
+	g.printf("// HashFields implements go_ohm.HashMarshaler.\n")
+	g.printf("func (v *%s) HashFields() ([]interface{}, error) {\n", name)
+	g.printf("args := make([]interface{}, 0, %d)\n", 2*len(fields))
+
+	for _, f := range fields {
+		x := "v." + f.name
+		call := g.marshalCall(f, x)
+		if f.ptr {
+			g.printf("if %s == nil {\n", x)
+			g.printf("args = append(args, %q, \"\")\n", f.hashField)
+			g.printf("} else ")
+		}
+
+		if call != "" {
+			g.printf("if s, err := %s; err != nil {\n", call)
+			g.printf("return nil, err\n")
+			g.printf("} else {\n")
+			g.printf("args = append(args, %q, s)\n", f.hashField)
+			g.printf("}\n")
+			g.useOhm()
+		} else if f.ptr {
+			g.printf("{\n")
+			g.printf("args = append(args, %q, %s)\n", f.hashField,
+				g.formatExpr(f.typ, "*"+x))
+			g.printf("}\n")
+		} else {
+			g.printf("args = append(args, %q, %s)\n", f.hashField,
+				g.formatExpr(f.typ, x))
+		}
+	}
+
+	g.printf("return args, nil\n")
+	g.printf("}\n\n")
+}
+
+func (g *generator) generateFromHash(name string, fields []*field) {
+	g.printf("// FromHash implements go_ohm.HashUnmarshaler.\n")
+	g.printf("func (v *%s) FromHash(fields map[string][]byte) error {\n", name)
+
+	for _, f := range fields {
+		x := "v." + f.name
+		g.printf("if b := fields[%q]; len(b) > 0 {\n", f.hashField)
+		if f.ptr {
+			g.printf("if %s == nil {\n", x)
+			g.printf("%s = new(%s)\n", x, g.typeString(f.typ))
+			g.printf("}\n")
+		}
+
+		if f.json || f.text {
+			p := x
+			if !f.ptr {
+				p = "&" + x
+			}
+
+			call := fmt.Sprintf("go_ohm.UnmarshalHashValue(%q, %q, b, %s)",
+				f.name, f.codec, p)
+			if f.text {
+				call = fmt.Sprintf("go_ohm.UnmarshalHashText(%q, b, %s)", f.name,
+					p)
+			}
+			g.printf("if err := %s; err != nil {\n", call)
+			g.printf("return err\n")
+			g.printf("}\n")
+			g.useOhm()
+		} else {
+			if f.ptr {
+				x = "*" + x
+			}
+			g.generateParse(f, x)
+		}
+
+		g.printf("}\n")
+	}
+
+	g.printf("return nil\n")
+	g.printf("}\n\n")
+}
+
+func (g *generator) useOhm() {
+	g.imports[ohmPath] = "go_ohm"
+}
+
+func (g *generator) useStrconv() {
+	g.imports["strconv"] = "strconv"
+}
+
+// formatExpr returns the expression formats `x` like go_ohm's
+// formatPlainValue().
+func (g *generator) formatExpr(typ types.Type, x string) string {
+	b, ok := typ.Underlying().(*types.Basic)
+	if !ok {
+		// byte slice.
+		return fmt.Sprintf("string(%s)", x)
+	}
+
+	info := b.Info()
+	switch {
+	case info&types.IsString != 0:
+		return fmt.Sprintf("string(%s)", x)
+	case info&types.IsBoolean != 0:
+		g.useStrconv()
+		return fmt.Sprintf("strconv.FormatBool(bool(%s))", x)
+	case info&types.IsUnsigned != 0:
+		g.useStrconv()
+		return fmt.Sprintf("strconv.FormatUint(uint64(%s), 10)", x)
+	case info&types.IsInteger != 0:
+		g.useStrconv()
+		return fmt.Sprintf("strconv.FormatInt(int64(%s), 10)", x)
+	case info&types.IsFloat != 0:
+		g.useStrconv()
+		return fmt.Sprintf("strconv.FormatFloat(float64(%s), 'g', -1, %d)", x,
+			bitSize(b))
+	default:
+		g.useStrconv()
+		return fmt.Sprintf("strconv.FormatComplex(complex128(%s), 'g', -1, %d)",
+			x, bitSize(b))
+	}
+}
+
+// generateParse generates code parses `b` into `x` like go_ohm's
+// plainObject.renderValue().
+func (g *generator) generateParse(f *field, x string) {
+	typ := g.typeString(f.typ)
+	if f.timeType == "Time" {
+		g.useOhm()
+		g.printf("p, err := go_ohm.ParseHashTime(%q, %q, b)\n", f.name,
+			f.timeFormat)
+		g.printf("if err != nil {\n")
+		g.printf("return err\n")
+		g.printf("}\n")
+		g.printf("%s = p\n", x)
+		return
+	}
+
+	b, ok := f.typ.Underlying().(*types.Basic)
+	if !ok || b.Info()&types.IsString != 0 {
+		// byte slice or string.
+		g.printf("%s = %s(b)\n", x, typ)
+		return
+	}
+
+	// type name in errors is same as reflect.Type.String()'s.
+	name := types.TypeString(f.typ, func(p *types.Package) string {
+		return p.Name()
+	})
+
+	var parse string
+	info := b.Info()
+	switch {
+	case f.timeType == "Duration":
+		parse = fmt.Sprintf("go_ohm.ParseHashDuration(%q, %q, b)", f.name,
+			f.timeFormat)
+	case info&types.IsBoolean != 0:
+		parse = fmt.Sprintf("go_ohm.ParseHashBool(%q, b, %q)", f.name, name)
+	case info&types.IsUnsigned != 0:
+		parse = fmt.Sprintf("go_ohm.ParseHashUint(%q, b, %q, %d)", f.name,
+			name, parseBitSize(b))
+	case info&types.IsInteger != 0:
+		parse = fmt.Sprintf("go_ohm.ParseHashInt(%q, b, %q, %d)", f.name,
+			name, parseBitSize(b))
+	case info&types.IsFloat != 0:
+		parse = fmt.Sprintf("go_ohm.ParseHashFloat(%q, b, %q, %d)", f.name,
+			name, parseBitSize(b))
+	default:
+		parse = fmt.Sprintf("go_ohm.ParseHashComplex(%q, b, %q, %d)", f.name,
+			name, parseBitSize(b))
+	}
+
+	g.useOhm()
+	g.printf("p, err := %s\n", parse)
+	g.printf("if err != nil {\n")
+	g.printf("return err\n")
+	g.printf("}\n")
+	g.printf("%s = %s(p)\n", x, typ)
+}
+
+// parseBitSize returns the bit size for strconv's parsing functions, 0 means
+// the size of int, which is same as reflect.Type.Bits() of int, uint and
+// uintptr.
+func parseBitSize(b *types.Basic) int {
+	switch b.Kind() {
+	case types.Int8, types.Uint8:
+		return 8
+	case types.Int16, types.Uint16:
+		return 16
+	case types.Int32, types.Uint32, types.Float32:
+		return 32
+	case types.Int64, types.Uint64, types.Float64, types.Complex64:
+		return 64
+	case types.Complex128:
+		return 128
+	default:
+		return 0
+	}
+}
+
+// bitSize returns the bit size for strconv.FormatFloat() and
+// strconv.FormatComplex().
+func bitSize(b *types.Basic) int {
+	switch b.Kind() {
+	case types.Float32:
+		return 32
+	case types.Complex128:
+		return 128
+	default:
+		return 64
+	}
+}
+
+func (g *generator) output() ([]byte, error) {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "%s\n\npackage %s\n\n", generatedBy, g.pkg.Name())
+
+	// standard packages first, then others.
+	var std, others []string
+	for p := range g.imports {
+		if strings.Contains(strings.SplitN(p, "/", 2)[0], ".") {
+			others = append(others, p)
+		} else {
+			std = append(std, p)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(others)
+
+	if len(std)+len(others) > 0 {
+		out.WriteString("import (\n")
+		for i, group := range [][]string{std, others} {
+			if i > 0 && len(std) > 0 && len(group) > 0 {
+				out.WriteString("\n")
+			}
+
+			for _, p := range group {
+				if name := g.imports[p]; name != filepath.Base(p) {
+					fmt.Fprintf(&out, "%s %q\n", name, p)
+				} else {
+					fmt.Fprintf(&out, "%q\n", p)
+				}
+			}
+		}
+		out.WriteString(")\n\n")
+	}
+
+	out.Write(g.buf.Bytes())
+	return format.Source(out.Bytes())
+}
@@ -3,7 +3,6 @@ package go_ohm
 import (
 	"fmt"
 	"reflect"
-	"strconv"
 
 	"github.com/gomodule/redigo/redis"
 )
@@ -14,86 +13,310 @@ type mapObject struct {
 	// Reflected type of index, for map only.
 	indexTyp reflect.Type
 
+	// Reflected concrete type of elements, pointers are stripped.
+	elemTyp reflect.Type
+
 	// redis reply of a redis hash.
 	reply map[string]string
+
+	// HSCAN cursor while loading by scan, see `ObjectOptions.ScanCount`.
+	// scanning is false once the cursor returns to "0".
+	cursor   string
+	scanning bool
+
+	// entries decoded from HSCAN replies page by page, which are rendered into
+	// the map by renderValue(). It is a map of the map's type.
+	scanned reflect.Value
 }
 
 func (o *mapObject) getDescendants(objList *[]*compoundObject) {
 	*objList = append(*objList, o.compoundObject)
 }
 
-func (o *mapObject) doRedisLoad(conn redis.Conn, ns string) error {
+func (o *mapObject) genLoadCommands(ns string) ([]*redisCommand, error) {
 	key, err := o.genRedisKey(ns)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	rep, err := redis.StringMap(conn.Do("HGETALL", key))
+	if o.ScanCount > 0 {
+		o.scanned = reflect.MakeMap(o.typ)
+		o.cursor = "0"
+		return []*redisCommand{o.genScanCommand(key)}, nil
+	}
+
+	cmd := newRedisCommand(o.compoundObject, "HGETALL", []interface{}{key},
+		func(reply interface{}) error {
+			rep, err := redis.StringMap(reply, nil)
+			if err != nil {
+				return newErrorRedisCommandFailed(o.name, err)
+			}
+
+			// redis removes empty hashes, so empty reply means not found.
+			o.reply = rep
+			o.notFound = len(rep) <= 0
+			return nil
+		})
+
+	return []*redisCommand{cmd}, nil
+}
+
+// genScanCommands generates the next HSCAN command if the map is being loaded
+// by scan.
+func (o *mapObject) genScanCommands(ns string) ([]*redisCommand, error) {
+	if !o.scanning {
+		return nil, nil
+	}
+
+	key, err := o.genRedisKey(ns)
 	if err != nil {
-		return newErrorRedisCommandFailed(o.name, err)
+		return nil, err
+	}
+
+	return []*redisCommand{o.genScanCommand(key)}, nil
+}
+
+func (o *mapObject) genScanCommand(key string) *redisCommand {
+	args := []interface{}{key, o.cursor, "COUNT", o.ScanCount}
+	return newRedisCommand(o.compoundObject, "HSCAN", args,
+		func(reply interface{}) error {
+			cursor, pairs, err := parseScanReply(reply)
+			if err != nil {
+				return newErrorRedisCommandFailed(o.name, err)
+			}
+
+			err = o.decodeScanPairs(pairs)
+			if err != nil {
+				return err
+			}
+
+			o.cursor = cursor
+			o.scanning = cursor != "0"
+			o.notFound = o.scanned.Len() <= 0
+			return nil
+		})
+}
+
+// decodeScanPairs decodes field value pairs of a HSCAN reply into `scanned`,
+// so replies are not kept. In "merge" mode, elements are decoded on the map's
+// current elements if the map exists, like renderValue() does.
+func (o *mapObject) decodeScanPairs(pairs []string) error {
+	merge := o.getLoadMode() != "reset" && !o.isNil() && !o.value.IsNil()
+	for i := 0; i < len(pairs); i += 2 {
+		k, err := o.newIndexValue(pairs[i])
+		if err != nil {
+			return err
+		}
+
+		old := reflect.Value{}
+		if merge {
+			old = o.value.MapIndex(*k)
+		}
+
+		v, err := o.newElemValue(pairs[i+1], old)
+		if err != nil {
+			return err
+		}
+
+		o.scanned.SetMapIndex(*k, *v)
 	}
 
-	o.reply = rep
 	return nil
 }
 
+// parseScanReply parses the reply of HSCAN into the next cursor and field value
+// pairs.
+func parseScanReply(reply interface{}) (string, []string, error) {
+	rep, err := redis.Values(reply, nil)
+	if err != nil {
+		return "", nil, err
+	} else if len(rep) != 2 {
+		return "", nil, fmt.Errorf("unexpected HSCAN reply length %d",
+			len(rep))
+	}
+
+	cursor, err := redis.String(rep[0], nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	pairs, err := redis.Strings(rep[1], nil)
+	if err != nil {
+		return "", nil, err
+	} else if len(pairs)%2 != 0 {
+		return "", nil, fmt.Errorf("odd number of HSCAN field values")
+	}
+
+	return cursor, pairs, nil
+}
+
 func (o *mapObject) genHashFieldValuePairs() ([]interface{}, error) {
 	var cmdArgs []interface{}
 
 	iter := o.value.MapRange()
 	for iter.Next() {
-		k := fmt.Sprint(iter.Key().Interface())
+		k, err := o.formatIndexValue(iter.Key())
+		if err != nil {
+			return nil, err
+		}
 
 		vv := iter.Value()
-		v, err := jsonMarshalValue(&vv)
+		v, err := o.genElemValue(&vv)
 		if err != nil {
-			return nil, newErrorJsonFailed(o.name, err)
+			return nil, err
 		}
 
-		cmdArgs = append(cmdArgs, k, string(v))
+		cmdArgs = append(cmdArgs, k, v)
 	}
 
 	return cmdArgs, nil
 }
 
-func (o *mapObject) newIndexValue(s string) (*reflect.Value, error) {
-	var v reflect.Value
-
-	switch o.indexTyp.Kind() {
-	case reflect.Int:
-		fallthrough
-	case reflect.Int8:
-		fallthrough
-	case reflect.Int16:
-		fallthrough
-	case reflect.Int32:
-		fallthrough
-	case reflect.Int64:
-		i, err := strconv.ParseInt(s, 10, 64)
+var (
+	primitiveIndexOptions = &ObjectOptions{}
+	marshalerIndexOptions = &ObjectOptions{Marshaler: true}
+)
+
+// indexOptions returns options of map keys, which are stored in the default
+// time format, and by their marshaler methods if implemented. Primitive keys,
+// like `type Color int`, are always stored by kind, even if they implement
+// marshalers.
+func indexOptions(typ reflect.Type) *ObjectOptions {
+	if isPrimitiveType(typ) {
+		return primitiveIndexOptions
+	}
+
+	return marshalerIndexOptions
+}
+
+// formatIndexValue formats the map key as the hash field, like non jsonified
+// plain values with `indexOptions()`.
+func (o *mapObject) formatIndexValue(k reflect.Value) (string, error) {
+	return formatValue(o.name, indexOptions(o.indexTyp), &k)
+}
+
+// genElemValue encodes the element by codec, or formats it like plain objects
+// if `ElemNonJson` is set. Nil pointers are formatted as "".
+func (o *mapObject) genElemValue(v *reflect.Value) (string, error) {
+	if !o.ElemNonJson {
+		bs, err := marshalValue(o.name, o.getCodec(), v)
 		if err != nil {
-			return nil, err
+			return "", err
+		}
+		return string(bs), nil
+	}
+
+	_, v, indirect := advanceIndirectTypeAndValue(v.Type(), v)
+	if indirect > 0 {
+		return "", nil
+	}
+
+	return formatValue(o.name, o.ObjectOptions, v)
+}
+
+// replaceMapScript replaces all fields of the hash. KEYS[1] is the hash, and
+// ARGV are field value pairs. Pairs are set in chunks, since unpack() can not
+// return too many values.
+const replaceMapScript = `
+redis.call('DEL', KEYS[1])
+for i = 1, #ARGV, 1000 do
+	redis.call('HMSET', KEYS[1], unpack(ARGV, i, math.min(i + 999, #ARGV)))
+end
+return 1
+`
+
+// genReplaceCommands replaces HMSET with replaceMapScript, so fields absent
+// from the map are removed atomically. An empty map removes the hash.
+func (o *mapObject) genReplaceCommands(key string,
+	pairs []interface{}) []*redisCommand {
+	args := []interface{}{replaceMapScript, 1, key}
+	args = append(args, pairs...)
+	return []*redisCommand{newRedisCommand(o.compoundObject, "EVAL", args, nil)}
+}
+
+// genLoadKeysCommands generates HMGET of hash fields `fields`. Existing fields
+// are stored to o.reply.
+func (o *mapObject) genLoadKeysCommands(ns string,
+	fields []string) ([]*redisCommand, error) {
+	key, err := o.genRedisKey(ns)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []interface{}{key}
+	for _, f := range fields {
+		args = append(args, f)
+	}
+
+	cmd := newRedisCommand(o.compoundObject, "HMGET", args,
+		func(reply interface{}) error {
+			rep, err := redis.Values(reply, nil)
+			if err != nil {
+				return newErrorRedisCommandFailed(o.name, err)
+			} else if len(rep) != len(fields) {
+				return newErrorBugOccurred(o.name)
+			}
+
+			o.reply = map[string]string{}
+			for i, r := range rep {
+				if r == nil {
+					continue
+				}
+
+				s, err := redis.String(r, nil)
+				if err != nil {
+					return newErrorRedisCommandFailed(o.name, err)
+				}
+				o.reply[fields[i]] = s
+			}
+
+			return nil
+		})
+
+	cmds := []*redisCommand{cmd}
+	cmds = append(cmds, o.genExpireCommands(key)...)
+	return cmds, nil
+}
+
+// renderKeysValue renders entries of `keys` like renderValue(), where
+// `fields` are their hash fields. It returns the keys which fields do not
+// exist, and deletes their entries if the load mode is "reset".
+func (o *mapObject) renderKeysValue(keys []reflect.Value,
+	fields []string) ([]interface{}, error) {
+	o.createIndirectValues()
+	if o.value.IsNil() {
+		o.value.Set(reflect.MakeMap(o.value.Type()))
+	}
+
+	var missing []interface{}
+	for i, k := range keys {
+		rv, ok := o.reply[fields[i]]
+		if !ok {
+			missing = append(missing, k.Interface())
+			if o.getLoadMode() == "reset" {
+				o.value.SetMapIndex(k, reflect.Value{})
+			}
+			continue
 		}
-		v = reflect.ValueOf(i).Convert(o.indexTyp)
-
-	case reflect.Uint:
-		fallthrough
-	case reflect.Uint8:
-		fallthrough
-	case reflect.Uint16:
-		fallthrough
-	case reflect.Uint32:
-		fallthrough
-	case reflect.Uint64:
-		fallthrough
-	case reflect.Uintptr:
-		u, err := strconv.ParseUint(s, 10, 64)
+
+		v, err := o.newElemValue(rv, o.value.MapIndex(k))
 		if err != nil {
 			return nil, err
 		}
-		v = reflect.ValueOf(u).Convert(o.indexTyp)
 
-	case reflect.String:
-		v = reflect.ValueOf(s)
+		o.value.SetMapIndex(k, *v)
+	}
+
+	return missing, nil
+}
+
+// newIndexValue parses the hash field into the map key. See
+// formatIndexValue().
+func (o *mapObject) newIndexValue(s string) (*reflect.Value, error) {
+	v := reflect.New(o.indexTyp).Elem()
+	err := parseValue(o.name, indexOptions(o.indexTyp), []byte(s), &v)
+	if err != nil {
+		return nil, err
 	}
 
 	return &v, nil
@@ -101,62 +324,106 @@ func (o *mapObject) newIndexValue(s string) (*reflect.Value, error) {
 
 func (o *mapObject) renderValue() error {
 	o.createIndirectValues()
-	if o.value.IsNil() {
-		o.value.Set(reflect.MakeMap(o.value.Type()))
+	if o.scanned.IsValid() {
+		return o.renderScannedValue()
 	}
 
-	if o.ElemNonJson {
-		return newErrorUnsupportedObjectType(o.name)
+	if o.value.IsNil() {
+		o.value.Set(reflect.MakeMap(o.value.Type()))
+	} else if o.getLoadMode() == "reset" {
+		o.resetValue()
 	}
 
 	for rk, rv := range o.reply {
 		k, err := o.newIndexValue(rk)
 		if err != nil {
-			return newErrorUnsupportedObjectType(o.name)
+			return err
 		}
 
-		// use reflect.New() to create a pointer to map's element, otherwise the
-		// element was unaddressable and unsettable.
-		v := o.value.MapIndex(*k)
-		p := reflect.New(o.typ.Elem())
-		if v.IsValid() {
-			p.Elem().Set(v)
+		v, err := o.newElemValue(rv, o.value.MapIndex(*k))
+		if err != nil {
+			return err
 		}
-		v = p.Elem()
 
-		vt, vv, vi := advanceIndirectTypeAndValue(v.Type(), &v)
-		if isIgnoredType(vt) {
-			return newErrorUnsupportedObjectType(o.name)
-		}
-		createIndirectValues(vv, vi)
+		o.value.SetMapIndex(*k, *v)
+	}
 
-		err = jsonUnmarshalValue([]byte(rv), vv)
-		if err != nil {
-			return newErrorJsonFailed(o.name, err)
-		}
+	return nil
+}
 
-		o.value.SetMapIndex(*k, v)
+// renderScannedValue renders entries decoded by decodeScanPairs().
+func (o *mapObject) renderScannedValue() error {
+	scanned := o.scanned
+	o.scanned = reflect.Value{}
+	if o.value.IsNil() {
+		o.value.Set(scanned)
+		return nil
+	} else if o.getLoadMode() == "reset" {
+		o.resetValue()
+	}
+
+	iter := scanned.MapRange()
+	for iter.Next() {
+		o.value.SetMapIndex(iter.Key(), iter.Value())
 	}
 
 	return nil
 }
 
+// newElemValue decodes `s` into a new element, which is initialized by `old`
+// if it is valid.
+func (o *mapObject) newElemValue(s string,
+	old reflect.Value) (*reflect.Value, error) {
+	// use reflect.New() to create a pointer to map's element, otherwise the
+	// element was unaddressable and unsettable.
+	p := reflect.New(o.typ.Elem())
+	if old.IsValid() {
+		p.Elem().Set(old)
+	}
+	v := p.Elem()
+
+	vt, vv, vi := advanceIndirectTypeAndValue(v.Type(), &v)
+	if isIgnoredType(vt) {
+		return nil, newErrorUnsupportedObjectType(o.name)
+	}
+
+	var err error
+	if !o.ElemNonJson {
+		createIndirectValues(vv, vi)
+		err = unmarshalValue(o.name, o.getCodec(), []byte(s), vv)
+	} else if len(s) > 0 {
+		// like plain objects, empty values are skipped, so nil pointers are
+		// kept nil.
+		createIndirectValues(vv, vi)
+		err = parseValue(o.name, o.ObjectOptions, []byte(s), vv)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// v may be advanced to the pointed value, so return p's.
+	e := p.Elem()
+	return &e, nil
+}
+
 func (o *mapObject) complete() error {
+	// keys are stored like non jsonified plain values, so they must be
+	// primitive types, or marshaler types like `time.Time`.
 	o.indexTyp = o.typ.Key()
+	if !isNativeType(o.indexTyp, indexOptions(o.indexTyp)) {
+		return newErrorUnsupportedObjectType(o.name)
+	}
 
-	switch o.indexTyp.Kind() {
-	case reflect.Int:
-	case reflect.Int8:
-	case reflect.Int16:
-	case reflect.Int32:
-	case reflect.Int64:
-	case reflect.Uint:
-	case reflect.Uint8:
-	case reflect.Uint16:
-	case reflect.Uint32:
-	case reflect.Uint64:
-	case reflect.String:
-	default:
+	o.elemTyp = o.typ.Elem()
+	for o.elemTyp.Kind() == reflect.Ptr {
+		o.elemTyp = o.elemTyp.Elem()
+	}
+
+	if o.ElemNonJson && !isNativeType(o.elemTyp, o.ObjectOptions) {
+		return newErrorUnsupportedObjectType(o.name)
+	} else if o.Marshaler && !isMarshalerType(o.elemTyp) {
+		return newErrorUnsupportedObjectType(o.name)
+	} else if !isTimeFormatSupported(o.elemTyp, o.TimeFormat) {
 		return newErrorUnsupportedObjectType(o.name)
 	}
 
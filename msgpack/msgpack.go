@@ -0,0 +1,35 @@
+// Package msgpack registers the "msgpack" codec (https://msgpack.org) by
+// github.com/vmihailenco/msgpack, which is more compact than json. Import it
+// for side effect:
+//
+//	import _ "github.com/abadcafe/go_ohm/msgpack"
+//
+// Then use it by `go_ohm.ObjectOptions.Codec` or struct tag:
+//
+//	type A struct {
+//		B map[string]int `go_ohm:"codec=msgpack"`
+//	}
+package msgpack
+
+import (
+	"github.com/abadcafe/go_ohm"
+	msgpackv5 "github.com/vmihailenco/msgpack/v5"
+)
+
+// Name of the codec.
+const Name = "msgpack"
+
+// Codec implements `go_ohm.Codec` by msgpack.
+type Codec struct{}
+
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	return msgpackv5.Marshal(v)
+}
+
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	return msgpackv5.Unmarshal(data, v)
+}
+
+func init() {
+	go_ohm.RegisterCodec(Name, Codec{})
+}
@@ -0,0 +1,60 @@
+package msgpack
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/abadcafe/go_ohm"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestCodec(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	c, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+	defer c.Close()
+
+	type payload struct {
+		A int
+		B []string
+	}
+
+	type parent struct {
+		P payload        `go_ohm:"codec=msgpack"`
+		M map[string]int `go_ohm:"hash_name=m,non_json"`
+	}
+
+	opts := &go_ohm.ObjectOptions{HashName: "p1", Codec: Name}
+	p1 := &parent{P: payload{A: 1, B: []string{"b"}}, M: map[string]int{"a": 1}}
+	err = go_ohm.Save(c, "test", opts, p1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := redis.Bytes(c.Do("HGET", "test#parent#p1", "P"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p payload
+	err = Codec{}.Unmarshal(bs, &p)
+	if err != nil || !reflect.DeepEqual(p, p1.P) {
+		t.Error("not encoded by msgpack: ", err, p)
+	}
+
+	p2 := &parent{}
+	err = go_ohm.Load(c, "test", opts, p2)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(p1, p2) {
+		t.Error("wrong value: ", p2)
+	}
+}
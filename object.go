@@ -1,6 +1,7 @@
 package go_ohm
 
 import (
+	"encoding"
 	"reflect"
 )
 
@@ -20,6 +21,9 @@ type object struct {
 	parent    *compoundObject
 	*ObjectOptions
 
+	// selected fields of struct, nil means all.
+	mask fieldMask
+
 	// Reflected concrete type of the object. If original reflected type is
 	// multiple level Pointer or Interface (A.K.A. indirect), here stored the
 	// concrete type of the Pointer or Interface.
@@ -59,12 +63,77 @@ var rootObjectName = "__root_object"
 
 func (o *object) isPlainObject() bool {
 	return (o.typ.Kind() != reflect.Struct && o.typ.Kind() != reflect.Map) ||
-		o.Json
+		o.Json || isNativeType(o.typ, o.ObjectOptions)
 }
 
 func (o *object) isPromotedObject() bool {
 	return o.typ.Kind() == reflect.Struct && o.anonymous && !o.Json &&
-		o.Reference == "" && o.HashName == ""
+		o.Reference == "" && o.HashName == "" &&
+		!isNativeType(o.typ, o.ObjectOptions)
+}
+
+// isNil reports whether the object has no concrete value, EX, it is a nil
+// pointer, or a field of a nil struct pointer.
+func (o *object) isNil() bool {
+	return o.value == nil || !o.value.IsValid() || o.indirect > 0
+}
+
+// getCodec returns the codec name of the object, which inherits the
+// ancestors'. "" means the default codec.
+func (o *object) getCodec() string {
+	if o.Codec != "" || o.parent == nil {
+		return o.Codec
+	}
+
+	return o.parent.getCodec()
+}
+
+// getMapMode returns the map save mode of the object, which inherits the
+// ancestors'. "" means "merge".
+func (o *object) getMapMode() string {
+	if o.MapMode != "" || o.parent == nil {
+		return o.MapMode
+	}
+
+	return o.parent.getMapMode()
+}
+
+func isValidMapMode(mode string) bool {
+	return mode == "" || mode == "merge" || mode == "replace"
+}
+
+func isValidLoadMode(mode string) bool {
+	return mode == "" || mode == "merge" || mode == "reset"
+}
+
+// getLoadMode returns the load mode of the object, which inherits the
+// ancestors'. "" means "merge".
+func (o *object) getLoadMode() string {
+	if o.LoadMode != "" || o.parent == nil {
+		return o.LoadMode
+	}
+
+	return o.parent.getLoadMode()
+}
+
+// resetValue zeroes the value, or deletes all entries if it is a map, since
+// the map may be unsettable. Nil values are left untouched.
+func (o *object) resetValue() {
+	if o.isNil() {
+		return
+	}
+
+	if o.value.Kind() == reflect.Map {
+		if o.value.IsNil() {
+			return
+		}
+		for _, k := range o.value.MapKeys() {
+			o.value.SetMapIndex(k, reflect.Value{})
+		}
+		return
+	}
+
+	o.value.Set(reflect.Zero(o.value.Type()))
 }
 
 func (o *object) createIndirectValues() {
@@ -78,12 +147,44 @@ func isIgnoredType(typ reflect.Type) bool {
 		knd == reflect.Interface
 }
 
+var (
+	textMarshalerType     = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType   = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	binaryMarshalerType   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+// isMarshalerType reports whether the pointer to `typ` implements both
+// `encoding.TextMarshaler` and `encoding.TextUnmarshaler`, or both of the
+// binary variants. Such types are stored by those methods if `Marshaler`
+// option is set.
+func isMarshalerType(typ reflect.Type) bool {
+	p := reflect.PtrTo(typ)
+	return (p.Implements(textMarshalerType) &&
+		p.Implements(textUnmarshalerType)) ||
+		(p.Implements(binaryMarshalerType) &&
+			p.Implements(binaryUnmarshalerType))
+}
+
+// isNativeType reports whether non jsonified values of `typ` are stored as raw
+// hash values with options `opts`. Besides primitive types, marshaler types
+// are stored so only if `Marshaler` is set, and `time.Time` if `Marshaler` or
+// `TimeFormat` is set.
+func isNativeType(typ reflect.Type, opts *ObjectOptions) bool {
+	return isPrimitiveType(typ) || (opts.Marshaler && isMarshalerType(typ)) ||
+		(typ == timeType && opts.TimeFormat != "")
+}
+
 func isPrimitiveType(typ reflect.Type) bool {
 	return (typ.Kind() == reflect.String) ||
 		(typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8) ||
 		(typ.Kind() >= reflect.Bool && typ.Kind() <= reflect.Complex128)
 }
 
+func isIntegerType(typ reflect.Type) bool {
+	return typ.Kind() >= reflect.Int && typ.Kind() <= reflect.Uintptr
+}
+
 func advanceIndirectTypeAndValue(typ reflect.Type,
 	val *reflect.Value) (reflect.Type, *reflect.Value, int) {
 	if val != nil && val.IsValid() {
@@ -118,13 +219,14 @@ func createIndirectValues(v *reflect.Value, indirect int) {
 }
 
 func newObject(name string, op uint, parent *compoundObject, opts *ObjectOptions,
-	typ reflect.Type, val *reflect.Value, indirect int, anon bool) (*object,
-	error) {
+	typ reflect.Type, val *reflect.Value, indirect int, anon bool,
+	mask fieldMask) (*object, error) {
 	obj := &object{
 		name:          name,
 		op:            op,
 		anonymous:     anon,
 		ObjectOptions: opts,
+		mask:          mask,
 		typ:           typ,
 		value:         val,
 		indirect:      indirect,
@@ -7,7 +7,11 @@
 package go_ohm
 
 import (
+	"context"
+	"fmt"
 	"reflect"
+	"strconv"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
 )
@@ -19,13 +23,14 @@ import (
 // behaviors, because `i` is the "root object" and is not a field of certain
 // struct, so can't use struct tag.
 //
-// Every option has a corresponding struct tag option, in snake case. For
+// Most options have a corresponding struct tag option, in snake case. For
 // instance:
 //   type A struct {
 //     A int `go_ohm:"hash_name=a"`
 //   }
 // The struct tag are parsed as a `ObjectOptions` internally, and customized
-// field `A`'s mapping result.
+// field `A`'s mapping result. `Cascade`, `Atomic` and `Watch` are for the root
+// object only, so they have no struct tag option.
 type ObjectOptions struct {
 	// Redis hash's name, for map and struct only. Default is field name.
 	HashName string
@@ -44,18 +49,110 @@ type ObjectOptions struct {
 	// Jsonify the struct field, and store as a hash field. This option
 	// corresponded two struct tag options: "json" and "non_json". For compound
 	// types, includes slice(except byte slice), array, map and struct, default
-	// is "json", and for other types default is "non_json".
+	// is "json", and for other types default is "non_json". The value is
+	// encoded by `Codec`.
 	Json bool
 
-	// Don't Jsonify elements of map. Only for field which type is map. default
-	// is jsonify all types.
+	// Store the non jsonified value by its methods of `encoding.TextMarshaler`
+	// and `encoding.TextUnmarshaler`, or of the binary variants if the text
+	// ones are not implemented, rather than by its kind, or in a hash for
+	// structs. The type must implement both methods of a variant, and it can
+	// not be used with `Json`, `HashName` or `Reference`. For map fields, it
+	// applies to `ElemNonJson` elements. Default is false, so struct types like
+	// `time.Time` are jsonified unless it or `TimeFormat` is set.
+	Marshaler bool
+
+	// Name of the codec encodes jsonified values, includes `Json` fields and
+	// map elements. The codec must be registered by RegisterCodec(), "json" and
+	// "gob" are registered by default. Default is "json". If not presented, it
+	// inherits the parent's.
+	Codec string
+
+	// Format of non jsonified `time.Time` and `time.Duration` fields. For
+	// `time.Time`, it is one of "rfc3339nano", "unix" and "unix_ms", default is
+	// "rfc3339nano", and unix formats are loaded as UTC time. A `time.Time`
+	// field is not jsonified by default only if it or `Marshaler` is set. For
+	// `time.Duration`, it is one of "ns", "ms", "s" and "string", default is
+	// "ns". Unix and integer formats are sortable, and usable with numeric
+	// commands like HINCRBY.
+	TimeFormat string
+
+	// Don't Jsonify elements of map, but store them like non jsonified plain
+	// fields, so numeric elements are usable with commands like HINCRBY. The
+	// elements must be primitive types, or types stored by `Marshaler` or
+	// `TimeFormat` if either is set. Only for field which type is
+	// map. default is jsonify all types.
 	ElemNonJson bool
+
+	// How Save() saves maps, "merge" or "replace". "merge" sets fields of
+	// current entries only, so fields of deleted entries are left in the hash.
+	// "replace" removes the fields absent from the map atomically, and removes
+	// the hash if the map is empty. Default is "merge". If not presented, it
+	// inherits the parent's.
+	MapMode string
+
+	// How Load() renders loaded hashes into the data struct, "merge" or
+	// "reset". "merge" sets loaded values only, so entries of maps and fields
+	// absent from redis keep their previous values. "reset" clears maps and
+	// zeroes loaded fields first, include those absent from redis, and zeroes
+	// the structs of not found hashes. Non nil pointers are kept, and the
+	// values they point to are reset. Default is "merge". If not presented, it
+	// inherits the parent's.
+	LoadMode string
+
+	// Load() reads the hash of map by HSCAN with this COUNT, rather than
+	// HGETALL, so loading huge maps does not block redis. It takes more round
+	// trips, and entries modified during loading may be missed or duplicated.
+	// Also the COUNT of ScanMap(). For map only. Default is 0, which means
+	// HGETALL.
+	ScanCount int
+
+	// The field stores version of the hash. Save() checks the version in redis
+	// is same as the field's value, then increases it, atomically. If not
+	// same, Save() returns `ErrorVersionConflict`. For integer fields only.
+	//
+	// Only the hash of the struct is protected, other hashes saved by the same
+	// Save() are still saved on conflicts. Unless `Atomic` is set, then
+	// versions are checked before saving, and nothing is saved on conflicts.
+	Version bool
+
+	// Load() returns `ErrorObjectNotFound` if the hash of the field does not
+	// exist. Otherwise the field is left untouched, so pointers are left nil.
+	// The root object is always required.
+	Required bool
+
+	// Expiration of the hash, for map and struct only. Save() sets it after the
+	// hash saved. If not presented, it inherits the parent's. The struct tag
+	// option's format is same as `time.ParseDuration()`, EX: "ttl=30m". The
+	// precision is millisecond, and a positive TTL under 1ms is rounded up.
+	TTL time.Duration
+
+	// Load() refreshes the expiration of the hash too, A.K.A. sliding
+	// expiration. Only meaningful if `TTL` is set. If not presented, it
+	// inherits the parent's.
+	SlidingTTL bool
+
+	// Delete hashes of `reference` fields too, recursively. Only for Delete()'s
+	// root object, so there is no corresponding struct tag option.
+	Cascade bool
+
+	// Execute all commands of Save() in a MULTI/EXEC transaction, so the
+	// hashes are saved atomically. Only for Save()'s root object, so there is
+	// no corresponding struct tag option.
+	Atomic bool
+
+	// WATCH all hashes read by Load(). Then a following atomic Save() on the
+	// same connection returns `ErrorTransactionConflict` if any of the hashes
+	// has been modified by others in between. Call "UNWATCH" on the connection
+	// if there is no following atomic Save(). Only for Load()'s root object,
+	// so there is no corresponding struct tag option.
+	Watch bool
 }
 
 // Load data struct from redis hash.
 //
-// `conn` is a redis connection created by external package `redigo`. See
-// https://github.com/gomodule/redigo.
+// `conn` is a redis connection, usually created by external package `redigo`.
+// See `Conn`.
 //
 // `ns` is namespace to classify hash keys. It is represented as prefix of hash
 // keys.
@@ -63,16 +160,30 @@ type ObjectOptions struct {
 // `opts` specified how to deal with data struct in `i`. See `ObjectOptions`.
 //
 // `i` is data struct, currently it supports struct pointer, map, and map
-// pointer. The map key must be int, uint or string.
+// pointer. The map key must be a primitive type, like string, bool, integer,
+// float or their named types, or types stored by `encoding.TextMarshaler` or
+// `encoding.BinaryMarshaler`, see `ObjectOptions.Marshaler`, which is always
+// applied to keys of non primitive types. Keys are stored like non jsonified
+// plain fields in the default time format, so `time.Time` keys are loaded in
+// the location of their formatted offsets.
 //
-// It returns `error` while failed.
-func Load(conn redis.Conn, ns string, opts *ObjectOptions, i interface{}) error {
-	objs, err := genObjectList(i, ObjectOpLoad, opts)
+// It returns `error` while failed. If the hash of root object does not exist,
+// the error is `ErrorObjectNotFound`.
+func Load(conn Conn, ns string, opts *ObjectOptions, i interface{}) error {
+	return LoadContext(context.Background(), conn, ns, opts, i)
+}
+
+// LoadContext is like Load(), but the commands are executed with context `ctx`
+// if `conn` implements `ConnWithContext`. And it stops loading descendants once
+// `ctx` is done.
+func LoadContext(ctx context.Context, conn Conn, ns string, opts *ObjectOptions,
+	i interface{}) error {
+	objs, err := genObjectList(i, ObjectOpLoad, opts, nil)
 	if err != nil {
 		return err
 	}
 
-	err = doLoadCommands(conn, ns, objs)
+	err = doLoadCommands(ctx, conn, ns, objs, opts.Watch)
 	if err != nil {
 		return err
 	}
@@ -82,18 +193,302 @@ func Load(conn redis.Conn, ns string, opts *ObjectOptions, i interface{}) error
 }
 
 // Save data struct to redis hash. See Load() for argument explanation.
-func Save(conn redis.Conn, ns string, opts *ObjectOptions, i interface{}) error {
-	objs, err := genObjectList(i, ObjectOpSave, opts)
+//
+// Like Load(), it walks the whole object graph, so the hashes of `hash_name` and
+// `reference` fields are saved too. Hash names of `reference` fields come from
+// the in-memory values of the referred fields. Nil fields are skipped.
+func Save(conn Conn, ns string, opts *ObjectOptions, i interface{}) error {
+	return SaveContext(context.Background(), conn, ns, opts, i)
+}
+
+// SaveContext is like Save(), but the commands are executed with context `ctx`
+// if `conn` implements `ConnWithContext`.
+func SaveContext(ctx context.Context, conn Conn, ns string, opts *ObjectOptions,
+	i interface{}) error {
+	objs, err := genObjectList(i, ObjectOpSave, opts, nil)
+	if err != nil {
+		return err
+	}
+
+	return doSaveCommands(ctx, conn, ns, objs, opts.Atomic)
+}
+
+// LoadFields loads only the specified fields of data struct, other fields are
+// left untouched. See Load() for argument explanation, and `i` must be a
+// struct or struct pointer.
+//
+// `fields` are go field paths of the struct, like "A.B", which means field "B"
+// of field "A". Fields of promoted structs are specified by their own names,
+// and the name of a promoted struct specifies all of its fields.
+// For a `hash_name` or `reference` field, all of its fields are loaded if no
+// sub-field specified. The fields referred by `reference` fields are always
+// loaded, since they determine hash names.
+//
+// It returns `ErrorFieldNotFound` if any of `fields` does not exist.
+func LoadFields(conn Conn, ns string, opts *ObjectOptions, i interface{},
+	fields ...string) error {
+	return LoadFieldsContext(context.Background(), conn, ns, opts, i,
+		fields...)
+}
+
+// LoadFieldsContext is like LoadFields(), but with context. See
+// LoadContext().
+func LoadFieldsContext(ctx context.Context, conn Conn, ns string,
+	opts *ObjectOptions, i interface{}, fields ...string) error {
+	if len(fields) <= 0 {
+		return nil
+	}
+
+	objs, err := genFieldsObjectList(i, ObjectOpLoad, opts, fields)
+	if err != nil {
+		return err
+	}
+
+	err = doLoadCommands(ctx, conn, ns, objs, opts.Watch)
 	if err != nil {
 		return err
 	}
 
-	return doSaveCommands(conn, ns, objs)
+	return objs[0].renderValue()
+}
+
+// LoadMapKeys loads only the entries of `keys` from the redis hash of map, by
+// HMGET. See Load() for argument explanation, and `i` must be a map or map
+// pointer. Other entries of the map are left untouched.
+//
+// `keys` must be of the map's key type, or types of the same kind, EX, string
+// constants for a map of named string keys. They are converted to the key type.
+//
+// It returns the keys which do not exist in the hash, in order of `keys`. The
+// entries of them are left untouched, or deleted if `opts.LoadMode` is
+// "reset". Unlike Load(), it is not an error if the hash does not exist.
+func LoadMapKeys(conn Conn, ns string, opts *ObjectOptions, i interface{},
+	keys ...interface{}) ([]interface{}, error) {
+	return LoadMapKeysContext(context.Background(), conn, ns, opts, i,
+		keys...)
+}
+
+// LoadMapKeysContext is like LoadMapKeys(), but with context. See
+// LoadContext().
+func LoadMapKeysContext(ctx context.Context, conn Conn, ns string,
+	opts *ObjectOptions, i interface{},
+	keys ...interface{}) ([]interface{}, error) {
+	objs, err := genObjectList(i, ObjectOpLoad, opts, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	mo, ok := objs[0].abstractCompoundObject.(*mapObject)
+	if !ok {
+		return nil, newErrorUnsupportedObjectType(objs[0].name)
+	} else if len(keys) <= 0 {
+		return nil, nil
+	}
+
+	kvs := make([]reflect.Value, len(keys))
+	fields := make([]string, len(keys))
+	for n, k := range keys {
+		kv := reflect.ValueOf(k)
+		if !kv.IsValid() || kv.Kind() != mo.indexTyp.Kind() ||
+			!kv.Type().ConvertibleTo(mo.indexTyp) {
+			return nil, newErrorUnsupportedObjectType(mo.name)
+		}
+
+		kvs[n] = kv.Convert(mo.indexTyp)
+		fields[n], err = mo.formatIndexValue(kvs[n])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cmds, err := mo.genLoadKeysCommands(ns, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	err = doRedisPipeline(ctx, conn, cmds)
+	if err != nil {
+		return nil, err
+	}
+
+	return mo.renderKeysValue(kvs, fields)
+}
+
+// SaveFields saves only the specified fields of data struct. See LoadFields()
+// for argument explanation. The `version` field is always saved if presented,
+// while the field referred by a selected `reference` field is only used to
+// generate the key, and is not saved unless selected too.
+func SaveFields(conn Conn, ns string, opts *ObjectOptions, i interface{},
+	fields ...string) error {
+	return SaveFieldsContext(context.Background(), conn, ns, opts, i,
+		fields...)
+}
+
+// SaveFieldsContext is like SaveFields(), but with context. See
+// SaveContext().
+func SaveFieldsContext(ctx context.Context, conn Conn, ns string,
+	opts *ObjectOptions, i interface{}, fields ...string) error {
+	if len(fields) <= 0 {
+		return nil
+	}
+
+	objs, err := genFieldsObjectList(i, ObjectOpSave, opts, fields)
+	if err != nil {
+		return err
+	}
+
+	return doSaveCommands(ctx, conn, ns, objs, opts.Atomic)
+}
+
+// Delete data struct's redis hash. See Load() for argument explanation.
+//
+// If `opts.Cascade` is true, hashes of `reference` fields are deleted too. The
+// hash names of them are loaded from redis before deleting. The hashes of
+// `hash_name` fields are never deleted, since they may be shared by others.
+func Delete(conn Conn, ns string, opts *ObjectOptions,
+	i interface{}) error {
+	objs, err := genObjectList(i, ObjectOpLoad, opts, nil)
+	if err != nil {
+		return err
+	}
+
+	var keys []interface{}
+	for _, level := range groupByLoadLevel(objs) {
+		var cmds []*redisCommand
+		for _, o := range level {
+			if o.parent != nil && (!opts.Cascade || !o.isCascadable()) {
+				continue
+			}
+
+			key, err := o.genRedisKey(ns)
+			if err != nil {
+				if o.parent != nil {
+					// the reference is empty, nothing to delete.
+					continue
+				}
+				return err
+			}
+			keys = append(keys, key)
+
+			_, ok := o.abstractCompoundObject.(*structObject)
+			if ok && opts.Cascade {
+				// load referred fields to determine hash names of descendants.
+				c, err := o.genLoadCommands(ns)
+				if err != nil {
+					return err
+				}
+				cmds = append(cmds, c...)
+			}
+		}
+
+		err = doRedisPipeline(context.Background(), conn, cmds)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = conn.Do("DEL", keys...)
+	if err != nil {
+		return newErrorRedisCommandFailed(objs[0].name, err)
+	}
+
+	return nil
+}
+
+// Exists reports whether data struct's redis hash exists. See Load() for
+// argument explanation, the content of `i` is not touched.
+func Exists(conn Conn, ns string, opts *ObjectOptions,
+	i interface{}) (bool, error) {
+	objs, err := genObjectList(i, ObjectOpLoad, opts, nil)
+	if err != nil {
+		return false, err
+	}
+
+	key, err := objs[0].genRedisKey(ns)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := redis.Int(conn.Do("EXISTS", key))
+	if err != nil {
+		return false, newErrorRedisCommandFailed(objs[0].name, err)
+	}
+
+	return n > 0, nil
+}
+
+// Count the redis hashes of data struct's type in namespace `ns`, by SCAN keys
+// matched "ns#HashPrefix#*". See Load() for argument explanation, only the type
+// of `i` and `opts.HashPrefix` are used. Keys which are not hashes are not
+// counted. It scans the whole keyspace, so do not call it frequently on large
+// databases.
+func Count(conn Conn, ns string, opts *ObjectOptions,
+	i interface{}) (int, error) {
+	objs, err := genObjectList(i, ObjectOpLoad, opts, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	pattern := objs[0].genRedisKeyPattern(ns)
+	ctx := context.Background()
+
+	// SCAN may return a key more than once, so the keys are deduplicated.
+	seen := map[string]struct{}{}
+	count := 0
+	cursor := 0
+	for {
+		rep, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", pattern,
+			"COUNT", scanCount))
+		if err != nil {
+			return 0, newErrorRedisCommandFailed(objs[0].name, err)
+		}
+
+		var keys []string
+		_, err = redis.Scan(rep, &cursor, &keys)
+		if err != nil {
+			return 0, newErrorRedisCommandFailed(objs[0].name, err)
+		}
+
+		var cmds []*redisCommand
+		for _, k := range keys {
+			if _, ok := seen[k]; ok {
+				continue
+			}
+			seen[k] = struct{}{}
+
+			cmd := newRedisCommand(objs[0], "TYPE", []interface{}{k},
+				func(reply interface{}) error {
+					typ, err := redis.String(reply, nil)
+					if err != nil {
+						return newErrorRedisCommandFailed(objs[0].name, err)
+					} else if typ == "hash" {
+						count++
+					}
+					return nil
+				})
+			cmds = append(cmds, cmd)
+		}
+
+		err = doRedisPipeline(ctx, conn, cmds)
+		if err != nil {
+			return 0, err
+		}
+
+		if cursor == 0 {
+			break
+		}
+	}
+
+	return count, nil
 }
 
-func genObjectList(i interface{}, op uint,
-	opts *ObjectOptions) ([]*compoundObject, error) {
+func genObjectList(i interface{}, op uint, opts *ObjectOptions,
+	mask fieldMask) ([]*compoundObject, error) {
 	name := rootObjectName
+	err := checkRootOptions(name, opts)
+	if err != nil {
+		return nil, err
+	}
 
 	t := reflect.TypeOf(i)
 	if t == nil {
@@ -109,9 +504,12 @@ func genObjectList(i interface{}, op uint,
 	if isIgnoredType(typ) {
 		// do not support those types, skip.
 		return nil, newErrorUnsupportedObjectType(name)
+	} else if opts.ScanCount > 0 && typ.Kind() != reflect.Map {
+		return nil, newErrorInvalidValue(name, strconv.Itoa(opts.ScanCount),
+			"ScanCount", fmt.Errorf("scan count is for maps only"))
 	}
 
-	obj, err := newObject(name, op, nil, opts, typ, val, indirect, false)
+	obj, err := newObject(name, op, nil, opts, typ, val, indirect, false, mask)
 	if err != nil {
 		return nil, err
 	} else if obj.isPlainObject() {
@@ -125,24 +523,177 @@ func genObjectList(i interface{}, op uint,
 	return objs, nil
 }
 
-func doLoadCommands(conn redis.Conn, ns string, objs []*compoundObject) error {
+// checkRootOptions validates options of the root object, which are passed by
+// callers rather than parsed from struct tags.
+func checkRootOptions(nam string, opts *ObjectOptions) error {
+	if !isValidMapMode(opts.MapMode) {
+		return newErrorInvalidValue(nam, opts.MapMode, "MapMode",
+			fmt.Errorf("unknown map mode"))
+	}
+	if !isValidLoadMode(opts.LoadMode) {
+		return newErrorInvalidValue(nam, opts.LoadMode, "LoadMode",
+			fmt.Errorf("unknown load mode"))
+	}
+
+	return nil
+}
+
+// groupByLoadLevel splits objects into levels, see getLoadLevel(). The order of
+// objects in the same level is kept.
+func groupByLoadLevel(objs []*compoundObject) [][]*compoundObject {
+	var levels [][]*compoundObject
 	for _, o := range objs {
-		err := o.doRedisLoad(conn, ns)
+		l := o.getLoadLevel()
+		for len(levels) <= l {
+			levels = append(levels, nil)
+		}
+		levels[l] = append(levels[l], o)
+	}
+
+	return levels
+}
+
+// genFieldsObjectList is like genObjectList(), but only selected fields are
+// generated.
+func genFieldsObjectList(i interface{}, op uint, opts *ObjectOptions,
+	fields []string) ([]*compoundObject, error) {
+	objs, err := genObjectList(i, op, opts, newFieldMask(fields))
+	if err != nil {
+		return nil, err
+	}
+
+	rootObj, ok := objs[0].abstractCompoundObject.(*structObject)
+	if !ok {
+		return nil, newErrorUnsupportedObjectType(objs[0].name)
+	}
+
+	for _, f := range fields {
+		if rootObj.findFieldPath(f) == nil {
+			return nil, newErrorFieldNotFound(rootObj.name, f)
+		}
+	}
+
+	return objs, nil
+}
+
+// doLoadCommands pipelines commands of each level, so the round trips are as
+// many as the levels rather than the objects. If `watch` is true, hashes are
+// watched before they are read.
+func doLoadCommands(ctx context.Context, conn Conn, ns string,
+	objs []*compoundObject, watch bool) error {
+	batch := [][]*compoundObject{objs}
+	return doBatchLoadCommands(ctx, conn, ns, batch, watch)[0]
+}
+
+// genLevelLoadCommands generates load commands of objects in the same level.
+func genLevelLoadCommands(ns string, level []*compoundObject,
+	watch bool) ([]*redisCommand, error) {
+	var cmds []*redisCommand
+	for _, o := range level {
+		if o.isAncestorNotFound() {
+			o.notFound = true
+			continue
+		} else if o.parent != nil && o.Reference != "" &&
+			o.genHashName() == "" && !o.Required {
+			// the reference is empty, treat as not found.
+			o.notFound = true
+			continue
+		}
+
+		if watch {
+			key, err := o.genRedisKey(ns)
+			if err != nil {
+				return nil, err
+			}
+			cmds = append(cmds,
+				newRedisCommand(o, "WATCH", []interface{}{key}, nil))
+		}
+
+		c, err := o.genLoadCommands(ns)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		cmds = append(cmds, c...)
+
+		if len(c) > 0 {
+			key, _ := o.genRedisKey(ns)
+			cmds = append(cmds, o.genExpireCommands(key)...)
+		}
+	}
+
+	return cmds, nil
+}
+
+// genLevelScanCommands generates the next HSCAN commands of maps in the level,
+// which are loaded by scan and not finished.
+func genLevelScanCommands(ns string,
+	level []*compoundObject) ([]*redisCommand, error) {
+	var cmds []*redisCommand
+	for _, o := range level {
+		mo, ok := o.abstractCompoundObject.(*mapObject)
+		if !ok {
+			continue
+		}
+
+		c, err := mo.genScanCommands(ns)
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, c...)
+	}
+
+	return cmds, nil
+}
+
+// checkLevelNotFound returns `ErrorObjectNotFound` if any required object in
+// the level is not found.
+func checkLevelNotFound(ns string, level []*compoundObject) error {
+	for _, o := range level {
+		if o.notFound && !o.isAncestorNotFound() &&
+			(o.parent == nil || o.Required) {
+			key, _ := o.genRedisKey(ns)
+			return newErrorObjectNotFound(o.name, key)
 		}
 	}
 
 	return nil
 }
 
-func doSaveCommands(conn redis.Conn, ns string, objs []*compoundObject) error {
+// doSaveCommands pipelines all commands, since hash names are determined by
+// in-memory values while saving. If `atomic` is true, they are executed in a
+// transaction.
+func doSaveCommands(ctx context.Context, conn Conn, ns string,
+	objs []*compoundObject, atomic bool) error {
+	batch := [][]*compoundObject{objs}
+	return doBatchSaveCommands(ctx, conn, ns, batch, atomic)[0]
+}
+
+// genSaveCommands generates save commands of all objects.
+func genSaveCommands(ns string,
+	objs []*compoundObject) ([]*redisCommand, error) {
+	var cmds []*redisCommand
 	for _, o := range objs {
-		err := o.doRedisSave(conn, ns)
+		c, err := o.genSaveCommands(ns)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		cmds = append(cmds, c...)
 	}
 
-	return nil
+	return cmds, nil
+}
+
+// genVersionCheckCommands generates version check commands of all objects.
+func genVersionCheckCommands(ns string,
+	objs []*compoundObject) ([]*redisCommand, error) {
+	var cmds []*redisCommand
+	for _, o := range objs {
+		c, err := o.genVersionCheckCommands(ns)
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, c...)
+	}
+
+	return cmds, nil
 }
@@ -1,10 +1,17 @@
 package go_ohm
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math"
+	"net"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/alicebob/miniredis/v2"
 	"github.com/davecgh/go-spew/spew"
@@ -172,11 +179,12 @@ func TestLoad(t *testing.T) {
 	})
 
 	t.Run("test Load() nil", func(t *testing.T) {
+		var e *ErrorObjectNotFound
 		t1 := &test1{}
 		err := Load(c, "test", &ObjectOptions{HashName: "test1"}, t1)
-		if err != nil {
+		if !errors.As(err, &e) {
 			t.Error(err)
-		} else if reflect.DeepEqual(t1, &test1{}) {
+		} else if !reflect.DeepEqual(t1, &test1{}) {
 			t.Error("wrong value: ", t1)
 		}
 	})
@@ -207,24 +215,6 @@ func TestLoad(t *testing.T) {
 			t.Error(err)
 		}
 
-		err = Save(c, "test",
-			&ObjectOptions{HashPrefix: "test2", HashName: "test2"}, s4)
-		if err != nil {
-			t.Error(err)
-		}
-
-		err = Save(c, "test",
-			&ObjectOptions{HashPrefix: "test3", HashName: "test3"}, &t1.test3)
-		if err != nil {
-			t.Error(err)
-		}
-
-		err = Save(c, "test",
-			&ObjectOptions{HashPrefix: "test4", HashName: "test4"}, &t1.M)
-		if err != nil {
-			t.Error(err)
-		}
-
 		err = Load(c, "test", &ObjectOptions{HashName: "test1"}, t2)
 		if err != nil {
 			t.Error(err)
@@ -256,3 +246,2606 @@ func TestLoad(t *testing.T) {
 
 	fmt.Println(redisServer.Dump())
 }
+
+func TestSaveCascading(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	c, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+
+	type child struct {
+		I int
+	}
+
+	type parent struct {
+		Ref    string
+		Child  *child `go_ohm:"reference=Ref,non_json"`
+		Child2 *child `go_ohm:"hash_name=child2,non_json"`
+		Child3 *child `go_ohm:"hash_name=child3,non_json"` // nil, not saved.
+	}
+
+	t.Run("test Save() referenced objects", func(t *testing.T) {
+		p1 := &parent{
+			Ref:    "c1",
+			Child:  &child{I: 1},
+			Child2: &child{I: 2},
+		}
+		err := Save(c, "test", &ObjectOptions{HashName: "p1"}, p1)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if v := redisServer.HGet("test#child#c1", "I"); v != "1" {
+			t.Error("wrong value: ", v)
+		}
+		if v := redisServer.HGet("test#child#child2", "I"); v != "2" {
+			t.Error("wrong value: ", v)
+		}
+		if redisServer.Exists("test#child#child3") {
+			t.Error("nil object saved")
+		}
+
+		p2 := &parent{}
+		err = Load(c, "test", &ObjectOptions{HashName: "p1"}, p2)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(p1.Child, p2.Child) ||
+			!reflect.DeepEqual(p1.Child2, p2.Child2) {
+			t.Error("loaded data not equal saved data")
+		}
+	})
+
+	t.Run("test Save() without reference key", func(t *testing.T) {
+		var e *ErrorObjectWithoutHashKey
+		p1 := &parent{Child: &child{I: 1}}
+		err := Save(c, "test", &ObjectOptions{HashName: "p2"}, p1)
+		if !errors.As(err, &e) {
+			t.Error(err)
+		}
+	})
+}
+
+func TestDelete(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	c, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+
+	type grandchild struct {
+		I int
+	}
+
+	type child struct {
+		Ref   string
+		Child *grandchild `go_ohm:"reference=Ref,non_json"`
+	}
+
+	type parent struct {
+		Ref    string
+		Child  *child `go_ohm:"reference=Ref,non_json"`
+		Shared *child `go_ohm:"hash_name=shared,non_json"`
+	}
+
+	p1 := &parent{
+		Ref:    "c1",
+		Child:  &child{Ref: "g1", Child: &grandchild{I: 1}},
+		Shared: &child{},
+	}
+
+	t.Run("test Delete() root object only", func(t *testing.T) {
+		err := Save(c, "test", &ObjectOptions{HashName: "p1"}, p1)
+		if err != nil {
+			t.Error(err)
+		}
+
+		err = Delete(c, "test", &ObjectOptions{HashName: "p1"}, &parent{})
+		if err != nil {
+			t.Error(err)
+		}
+
+		if redisServer.Exists("test#parent#p1") ||
+			!redisServer.Exists("test#child#c1") ||
+			!redisServer.Exists("test#grandchild#g1") {
+			t.Error("wrong keys: ", redisServer.Keys())
+		}
+	})
+
+	t.Run("test Delete() cascading", func(t *testing.T) {
+		err := Save(c, "test", &ObjectOptions{HashName: "p1"}, p1)
+		if err != nil {
+			t.Error(err)
+		}
+
+		err = Delete(c, "test", &ObjectOptions{HashName: "p1", Cascade: true},
+			&parent{})
+		if err != nil {
+			t.Error(err)
+		}
+
+		if redisServer.Exists("test#parent#p1") ||
+			redisServer.Exists("test#child#c1") ||
+			redisServer.Exists("test#grandchild#g1") ||
+			!redisServer.Exists("test#child#shared") {
+			t.Error("wrong keys: ", redisServer.Keys())
+		}
+	})
+}
+
+// flushCounter counts round trips of a redis connection.
+type flushCounter struct {
+	redis.Conn
+	flushes int
+}
+
+func (c *flushCounter) Flush() error {
+	c.flushes++
+	return c.Conn.Flush()
+}
+
+func TestPipeline(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	conn, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+	c := &flushCounter{Conn: conn}
+
+	type grandchild struct {
+		I int
+	}
+
+	type child struct {
+		Ref   string
+		Child *grandchild `go_ohm:"reference=Ref,non_json"`
+	}
+
+	type parent struct {
+		Ref    string
+		Child  *child         `go_ohm:"reference=Ref,non_json"`
+		Child2 *child         `go_ohm:"hash_name=c2,non_json"`
+		Child3 *child         `go_ohm:"hash_name=c3,non_json"`
+		M      map[string]int `go_ohm:"hash_name=m,non_json"`
+	}
+
+	p1 := &parent{
+		Ref:    "c1",
+		Child:  &child{Ref: "g1", Child: &grandchild{I: 1}},
+		Child2: &child{Ref: "g2", Child: &grandchild{I: 2}},
+		Child3: &child{Ref: "g1", Child: &grandchild{I: 1}},
+		M:      map[string]int{"a": 1},
+	}
+
+	t.Run("test Save() pipelined", func(t *testing.T) {
+		c.flushes = 0
+		err := Save(c, "test", &ObjectOptions{HashName: "p1"}, p1)
+		if err != nil {
+			t.Error(err)
+		} else if c.flushes != 1 {
+			t.Error("wrong round trips: ", c.flushes)
+		}
+	})
+
+	t.Run("test Load() pipelined by levels", func(t *testing.T) {
+		c.flushes = 0
+		p2 := &parent{}
+		err := Load(c, "test", &ObjectOptions{HashName: "p1"}, p2)
+		if err != nil {
+			t.Error(err)
+		} else if c.flushes != 3 {
+			t.Error("wrong round trips: ", c.flushes)
+		} else if !reflect.DeepEqual(p1, p2) {
+			t.Error("loaded data not equal saved data")
+		}
+	})
+
+	t.Run("test pipeline stops at broken connection", func(t *testing.T) {
+		bc := &brokenReceiveConn{Conn: conn}
+		err := Save(bc, "test", &ObjectOptions{HashName: "p1"}, p1)
+		if !errors.Is(err, errBrokenReceive) {
+			t.Error(err)
+		} else if bc.receives != 1 {
+			t.Error("wrong receives: ", bc.receives)
+		}
+
+		bc.receives = 0
+		err = Save(bc, "test", &ObjectOptions{HashName: "p1", Atomic: true},
+			p1)
+		if !errors.Is(err, errBrokenReceive) {
+			t.Error(err)
+		} else if bc.receives != 1 {
+			t.Error("wrong receives: ", bc.receives)
+		}
+	})
+}
+
+var errBrokenReceive = errors.New("broken connection")
+
+// brokenReceiveConn fails every Receive() as a broken connection.
+type brokenReceiveConn struct {
+	redis.Conn
+	receives int
+}
+
+func (c *brokenReceiveConn) Receive() (interface{}, error) {
+	c.receives++
+	return nil, errBrokenReceive
+}
+
+func TestAtomicSave(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	c, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+
+	c2, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+
+	type child struct {
+		I int
+	}
+
+	type parent struct {
+		Ref   string
+		Child *child `go_ohm:"reference=Ref,non_json"`
+	}
+
+	opts := &ObjectOptions{HashName: "p1", Atomic: true, Watch: true}
+	p1 := &parent{Ref: "c1", Child: &child{I: 1}}
+
+	t.Run("test Save() atomically", func(t *testing.T) {
+		err := Save(c, "test", opts, p1)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if v := redisServer.HGet("test#child#c1", "I"); v != "1" {
+			t.Error("wrong value: ", v)
+		}
+	})
+
+	t.Run("test Save() after watched Load()", func(t *testing.T) {
+		p2 := &parent{}
+		err := Load(c, "test", opts, p2)
+		if err != nil {
+			t.Error(err)
+		}
+
+		p2.Child.I = 2
+		err = Save(c, "test", opts, p2)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if v := redisServer.HGet("test#child#c1", "I"); v != "2" {
+			t.Error("wrong value: ", v)
+		}
+	})
+
+	t.Run("test Save() conflicted", func(t *testing.T) {
+		var e *ErrorTransactionConflict
+
+		p2 := &parent{}
+		err := Load(c, "test", opts, p2)
+		if err != nil {
+			t.Error(err)
+		}
+
+		// modify the referenced hash by other connection.
+		_, err = c2.Do("HSET", "test#child#c1", "I", 3)
+		if err != nil {
+			t.Error(err)
+		}
+
+		p2.Child.I = 4
+		err = Save(c, "test", opts, p2)
+		if !errors.As(err, &e) {
+			t.Error(err)
+		}
+
+		if v := redisServer.HGet("test#child#c1", "I"); v != "3" {
+			t.Error("wrong value: ", v)
+		}
+	})
+
+	t.Run("test empty Save() unwatches", func(t *testing.T) {
+		m := map[string]int{}
+		mopts := &ObjectOptions{HashName: "m", Atomic: true, Watch: true}
+		err := Load(c, "test", mopts, m)
+		if _, ok := err.(*ErrorObjectNotFound); !ok {
+			t.Error(err)
+		}
+
+		err = Save(c, "test", mopts, m)
+		if err != nil {
+			t.Error(err)
+		}
+
+		// the following transaction is not affected by the former WATCH.
+		_, err = c2.Do("HSET", "test##m", "a", 1)
+		if err != nil {
+			t.Error(err)
+		}
+
+		c.Send("MULTI")
+		c.Send("HSET", "test##m", "b", 2)
+		rep, err := c.Do("EXEC")
+		if err != nil || rep == nil {
+			t.Error("transaction aborted: ", rep, err)
+		}
+	})
+
+	t.Run("test failed Send() discards", func(t *testing.T) {
+		fc := &failingSendConn{Conn: c, fails: 2}
+		p2 := &parent{Ref: "c2", Child: &child{I: 5}}
+		err := Save(fc, "test", opts, p2)
+		if err == nil {
+			t.Error("should fail")
+		}
+
+		// the connection is not left in MULTI state.
+		v, err := redis.String(c.Do("PING"))
+		if err != nil || v != "PONG" {
+			t.Error("wrong reply: ", v, err)
+		}
+
+		if redisServer.Exists("test#child#c2") {
+			t.Error("should not be saved")
+		}
+	})
+}
+
+// failingSendConn fails the `fails`th Send().
+type failingSendConn struct {
+	redis.Conn
+	sends int
+	fails int
+}
+
+func (c *failingSendConn) Send(cmd string, args ...interface{}) error {
+	c.sends++
+	if c.sends == c.fails {
+		return errors.New("send failed")
+	}
+	return c.Conn.Send(cmd, args...)
+}
+
+func TestVersion(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	c, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+
+	type versioned struct {
+		V uint `go_ohm:"version"`
+		I int
+	}
+
+	opts := &ObjectOptions{HashName: "v1"}
+
+	t.Run("test Save() increases version", func(t *testing.T) {
+		v1 := &versioned{I: 1}
+		err := Save(c, "test", opts, v1)
+		if err != nil {
+			t.Error(err)
+		} else if v1.V != 1 {
+			t.Error("wrong version: ", v1.V)
+		}
+
+		v1.I = 2
+		err = Save(c, "test", opts, v1)
+		if err != nil {
+			t.Error(err)
+		} else if v1.V != 2 {
+			t.Error("wrong version: ", v1.V)
+		}
+
+		if v := redisServer.HGet("test#versioned#v1", "V"); v != "2" {
+			t.Error("wrong value: ", v)
+		}
+	})
+
+	t.Run("test Save() version conflicted", func(t *testing.T) {
+		var e *ErrorVersionConflict
+
+		v1 := &versioned{}
+		v2 := &versioned{}
+		err := Load(c, "test", opts, v1)
+		if err != nil {
+			t.Error(err)
+		}
+		err = Load(c, "test", opts, v2)
+		if err != nil {
+			t.Error(err)
+		}
+
+		v1.I = 3
+		err = Save(c, "test", opts, v1)
+		if err != nil {
+			t.Error(err)
+		}
+
+		v2.I = 4
+		err = Save(c, "test", opts, v2)
+		if !errors.As(err, &e) {
+			t.Error(err)
+		} else if v2.V != 2 {
+			t.Error("wrong version: ", v2.V)
+		}
+
+		if v := redisServer.HGet("test#versioned#v1", "I"); v != "3" {
+			t.Error("wrong value: ", v)
+		}
+	})
+
+	t.Run("test Save() expires versioned hash", func(t *testing.T) {
+		var e *ErrorVersionConflict
+
+		topts := &ObjectOptions{HashName: "v2", TTL: time.Minute}
+		v1 := &versioned{I: 1}
+		err := Save(c, "test", topts, v1)
+		if err != nil {
+			t.Error(err)
+		}
+
+		ttl := redisServer.TTL("test#versioned#v2")
+		if ttl != time.Minute {
+			t.Error("wrong ttl: ", ttl)
+		}
+
+		// a conflicted Save() does not set the expiration.
+		redisServer.SetTTL("test#versioned#v2", time.Second)
+		v2 := &versioned{I: 2}
+		err = Save(c, "test", topts, v2)
+		if !errors.As(err, &e) {
+			t.Error(err)
+		}
+
+		ttl = redisServer.TTL("test#versioned#v2")
+		if ttl != time.Second {
+			t.Error("wrong ttl: ", ttl)
+		}
+	})
+
+	t.Run("test atomic Save() conflicted saves nothing", func(t *testing.T) {
+		var e *ErrorVersionConflict
+
+		type child struct {
+			I int
+		}
+
+		type parent struct {
+			V     int `go_ohm:"version"`
+			Ref   string
+			Child *child `go_ohm:"reference=Ref,non_json"`
+		}
+
+		aopts := &ObjectOptions{HashName: "p1", Atomic: true}
+		p1 := &parent{Ref: "c1", Child: &child{I: 1}}
+		err := Save(c, "test", aopts, p1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stale := &parent{Ref: "c1", Child: &child{I: 99}}
+		err = Save(c, "test", aopts, stale)
+		if !errors.As(err, &e) {
+			t.Error(err)
+		}
+
+		if v := redisServer.HGet("test#child#c1", "I"); v != "1" {
+			t.Error("wrong value: ", v)
+		}
+		if v := redisServer.HGet("test#parent#p1", "V"); v != "1" {
+			t.Error("wrong version: ", v)
+		}
+
+		// the connection is usable, and the keys are not watched.
+		p1.Child.I = 2
+		err = Save(c, "test", aopts, p1)
+		if err != nil {
+			t.Error(err)
+		} else if v := redisServer.HGet("test#child#c1", "I"); v != "2" {
+			t.Error("wrong value: ", v)
+		}
+	})
+
+	t.Run("test version option on unsupported type", func(t *testing.T) {
+		var e *ErrorUnsupportedObjectType
+		v := &struct {
+			V string `go_ohm:"version"`
+		}{}
+		err := Save(c, "test", opts, v)
+		if !errors.As(err, &e) {
+			t.Error(err)
+		}
+	})
+}
+
+func TestLoadNotFound(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	c, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+
+	type child struct {
+		I int
+	}
+
+	type parent struct {
+		I      int
+		Ref    string
+		Child  *child         `go_ohm:"reference=Ref,non_json"`
+		Child2 *child         `go_ohm:"hash_name=c2,non_json"`
+		M      map[string]int `go_ohm:"hash_name=m,non_json"`
+	}
+
+	type parent2 struct {
+		I     int
+		Child *child `go_ohm:"hash_name=c2,non_json,required"`
+	}
+
+	err = Save(c, "test", &ObjectOptions{HashName: "p1"}, &parent{I: 1})
+	if err != nil {
+		panic(err)
+	}
+
+	t.Run("test Load() missing root object", func(t *testing.T) {
+		var e *ErrorObjectNotFound
+		err := Load(c, "test", &ObjectOptions{HashName: "p2"}, &parent{})
+		if !errors.As(err, &e) {
+			t.Error(err)
+		}
+
+		err = Load(c, "test", &ObjectOptions{HashName: "m2"},
+			&map[string]int{})
+		if !errors.As(err, &e) {
+			t.Error(err)
+		}
+	})
+
+	t.Run("test Load() missing optional descendants", func(t *testing.T) {
+		p := &parent{}
+		err := Load(c, "test", &ObjectOptions{HashName: "p1"}, p)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(p, &parent{I: 1}) {
+			t.Error("wrong value: ", p)
+		}
+	})
+
+	t.Run("test Load() missing required descendants", func(t *testing.T) {
+		var e *ErrorObjectNotFound
+		err := Load(c, "test", &ObjectOptions{HashName: "p1",
+			HashPrefix: "parent"}, &parent2{})
+		if !errors.As(err, &e) {
+			t.Error(err)
+		}
+	})
+	t.Run("test Load() hash of unmapped fields", func(t *testing.T) {
+		redisServer.HSet("test#child#c3", "unmapped", "1")
+		ch := &child{I: 1}
+		err := Load(c, "test", &ObjectOptions{HashName: "c3"}, ch)
+		if err != nil {
+			t.Error(err)
+		} else if ch.I != 1 {
+			t.Error("wrong value: ", ch.I)
+		}
+	})
+}
+
+func TestExistsAndCount(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	c, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+
+	type counted struct {
+		I int
+	}
+
+	for i := 0; i < 250; i++ {
+		err := Save(c, "test*", &ObjectOptions{HashName: fmt.Sprint(i)},
+			&counted{I: i})
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	err = Save(c, "test", &ObjectOptions{HashName: "1"}, &counted{})
+	if err != nil {
+		panic(err)
+	}
+
+	// not a hash.
+	redisServer.Set("test*#counted#str", "1")
+
+	t.Run("test Exists()", func(t *testing.T) {
+		ok, err := Exists(c, "test*", &ObjectOptions{HashName: "1"},
+			&counted{})
+		if err != nil || !ok {
+			t.Error(ok, err)
+		}
+
+		ok, err = Exists(c, "test*", &ObjectOptions{HashName: "250"},
+			&counted{})
+		if err != nil || ok {
+			t.Error(ok, err)
+		}
+	})
+
+	t.Run("test Count()", func(t *testing.T) {
+		n, err := Count(c, "test*", &ObjectOptions{}, (*counted)(nil))
+		if err != nil || n != 250 {
+			t.Error(n, err)
+		}
+
+		n, err = Count(c, "test*", &ObjectOptions{HashPrefix: "other"},
+			(*counted)(nil))
+		if err != nil || n != 0 {
+			t.Error(n, err)
+		}
+
+		// duplicated keys of SCAN are counted once.
+		n, err = Count(&dupScanConn{Conn: c}, "test*", &ObjectOptions{},
+			(*counted)(nil))
+		if err != nil || n != 250 {
+			t.Error(n, err)
+		}
+	})
+}
+
+// dupScanConn replies every key of SCAN twice.
+type dupScanConn struct {
+	redis.Conn
+}
+
+func (c *dupScanConn) Do(cmd string, args ...interface{}) (interface{},
+	error) {
+	rep, err := c.Conn.Do(cmd, args...)
+	if err != nil || cmd != "SCAN" {
+		return rep, err
+	}
+
+	vals := rep.([]interface{})
+	keys := vals[1].([]interface{})
+	return []interface{}{vals[0], append(keys, keys...)}, nil
+}
+
+func TestTTL(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	c, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+
+	type child struct {
+		I int
+	}
+
+	type session struct {
+		I      int
+		Ref    string
+		Child  *child `go_ohm:"reference=Ref,non_json"`
+		Child2 *child `go_ohm:"hash_name=c2,non_json,ttl=1h"`
+	}
+
+	s1 := &session{I: 1, Ref: "c1", Child: &child{}, Child2: &child{}}
+	opts := &ObjectOptions{HashName: "s1", TTL: time.Minute}
+
+	t.Run("test Save() with TTL", func(t *testing.T) {
+		err := Save(c, "test", opts, s1)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if ttl := redisServer.TTL("test#session#s1"); ttl != time.Minute {
+			t.Error("wrong ttl: ", ttl)
+		}
+		if ttl := redisServer.TTL("test#child#c1"); ttl != time.Minute {
+			t.Error("wrong ttl: ", ttl)
+		}
+		if ttl := redisServer.TTL("test#child#c2"); ttl != time.Hour {
+			t.Error("wrong ttl: ", ttl)
+		}
+	})
+
+	t.Run("test Load() with sliding TTL", func(t *testing.T) {
+		redisServer.FastForward(30 * time.Second)
+		err := Load(c, "test", opts, &session{})
+		if err != nil {
+			t.Error(err)
+		}
+
+		if ttl := redisServer.TTL("test#session#s1"); ttl != 30*time.Second {
+			t.Error("wrong ttl: ", ttl)
+		}
+
+		slidingOpts := *opts
+		slidingOpts.SlidingTTL = true
+		err = Load(c, "test", &slidingOpts, &session{})
+		if err != nil {
+			t.Error(err)
+		}
+
+		if ttl := redisServer.TTL("test#session#s1"); ttl != time.Minute {
+			t.Error("wrong ttl: ", ttl)
+		}
+		if ttl := redisServer.TTL("test#child#c1"); ttl != time.Minute {
+			t.Error("wrong ttl: ", ttl)
+		}
+	})
+
+	t.Run("test Save() with TTL under 1ms", func(t *testing.T) {
+		err := Save(c, "test", &ObjectOptions{HashName: "s2",
+			TTL: time.Microsecond}, &session{I: 2})
+		if err != nil {
+			t.Error(err)
+		}
+
+		ttl := redisServer.TTL("test#session#s2")
+		if ttl != time.Millisecond {
+			t.Error("wrong ttl: ", ttl)
+		}
+	})
+
+	t.Run("test invalid ttl tag", func(t *testing.T) {
+		var e *ErrorInvalidStructTag
+		v := &struct {
+			C *child `go_ohm:"hash_name=c3,non_json,ttl=1x"`
+		}{}
+		err := Save(c, "test", opts, v)
+		if !errors.As(err, &e) {
+			t.Error(err)
+		}
+	})
+}
+
+func TestSaveFields(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	c, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+
+	type child struct {
+		I int
+	}
+
+	type promoted struct {
+		P int
+	}
+
+	type parent struct {
+		V     int `go_ohm:"version"`
+		A     int
+		B     string
+		Ref   string
+		Child *child `go_ohm:"reference=Ref,non_json"`
+		promoted
+	}
+
+	opts := &ObjectOptions{HashName: "p1"}
+	p1 := &parent{A: 1, B: "1", Ref: "c1", Child: &child{I: 1},
+		promoted: promoted{P: 1}}
+	err = Save(c, "test", opts, p1)
+	if err != nil {
+		panic(err)
+	}
+
+	t.Run("test SaveFields()", func(t *testing.T) {
+		p1.A, p1.B, p1.P, p1.Child.I = 2, "2", 2, 2
+		err := SaveFields(c, "test", opts, p1, "A", "P")
+		if err != nil {
+			t.Error(err)
+		}
+
+		p2 := &parent{}
+		err = Load(c, "test", opts, p2)
+		if err != nil {
+			t.Error(err)
+		} else if p2.V != 2 || p2.A != 2 || p2.B != "1" || p2.P != 2 ||
+			p2.Child.I != 1 {
+			t.Error("wrong value: ", p2)
+		}
+	})
+
+	t.Run("test SaveFields() referenced object", func(t *testing.T) {
+		// the reference field is used to resolve the key, but not saved.
+		redisServer.HSet("test#parent#p1", "Ref", "c2")
+		p1.Ref = "c1"
+		err := SaveFields(c, "test", opts, p1, "Child")
+		if err != nil {
+			t.Error(err)
+		}
+
+		if v := redisServer.HGet("test#child#c1", "I"); v != "2" {
+			t.Error("wrong value: ", v)
+		}
+		if v := redisServer.HGet("test#parent#p1", "Ref"); v != "c2" {
+			t.Error("wrong value: ", v)
+		}
+		redisServer.HSet("test#parent#p1", "Ref", "c1")
+	})
+
+	t.Run("test SaveFields() promoted struct", func(t *testing.T) {
+		p1.P = 3
+		err := SaveFields(c, "test", opts, p1, "promoted")
+		if err != nil {
+			t.Error(err)
+		}
+
+		if v := redisServer.HGet("test#parent#p1", "P"); v != "3" {
+			t.Error("wrong value: ", v)
+		}
+	})
+
+	t.Run("test SaveFields() unknown field", func(t *testing.T) {
+		var e *ErrorFieldNotFound
+		err := SaveFields(c, "test", opts, p1, "A", "C")
+		if !errors.As(err, &e) {
+			t.Error(err)
+		}
+	})
+}
+
+func TestLoadFields(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	conn, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+	c := &flushCounter{Conn: conn}
+
+	type grandchild struct {
+		I int
+	}
+
+	type child struct {
+		I     int
+		J     int
+		Ref   string
+		Child *grandchild `go_ohm:"reference=Ref,non_json"`
+	}
+
+	type promoted struct {
+		P int
+	}
+
+	type parent struct {
+		A     int
+		B     string
+		Ref   string
+		Child *child `go_ohm:"reference=Ref,non_json"`
+		promoted
+	}
+
+	opts := &ObjectOptions{HashName: "p1"}
+	p1 := &parent{A: 1, B: "1", Ref: "c1",
+		Child:    &child{I: 1, J: 1, Ref: "g1", Child: &grandchild{I: 1}},
+		promoted: promoted{P: 1}}
+	err = Save(c, "test", opts, p1)
+	if err != nil {
+		panic(err)
+	}
+
+	t.Run("test LoadFields()", func(t *testing.T) {
+		p2 := &parent{}
+		c.flushes = 0
+		err := LoadFields(c, "test", opts, p2, "A", "P", "Child.I")
+		if err != nil {
+			t.Error(err)
+		} else if c.flushes != 2 {
+			t.Error("wrong round trips: ", c.flushes)
+		}
+
+		p3 := &parent{A: 1, Ref: "c1", Child: &child{I: 1},
+			promoted: promoted{P: 1}}
+		if !reflect.DeepEqual(p2, p3) {
+			t.Error("wrong value: ", p2)
+		}
+	})
+
+	t.Run("test LoadFields() promoted struct", func(t *testing.T) {
+		p2 := &parent{}
+		err := LoadFields(c, "test", opts, p2, "promoted")
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(p2, &parent{promoted: promoted{P: 1}}) {
+			t.Error("wrong value: ", p2)
+		}
+	})
+
+	t.Run("test LoadFields() missing fields", func(t *testing.T) {
+		p2 := &parent{}
+		_, err := c.Do("HDEL", "test#parent#p1", "A")
+		if err != nil {
+			t.Error(err)
+		}
+
+		err = LoadFields(c, "test", opts, p2, "A")
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(p2, &parent{}) {
+			t.Error("wrong value: ", p2)
+		}
+	})
+
+	t.Run("test LoadFields() unknown field", func(t *testing.T) {
+		var e *ErrorFieldNotFound
+		err := LoadFields(c, "test", opts, &parent{}, "Child.K")
+		if !errors.As(err, &e) {
+			t.Error(err)
+		}
+	})
+}
+
+func TestContext(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	c, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+
+	type child struct {
+		I int
+	}
+
+	type parent struct {
+		Ref   string
+		Child *child `go_ohm:"reference=Ref,non_json"`
+	}
+
+	opts := &ObjectOptions{HashName: "p1"}
+	p1 := &parent{Ref: "c1", Child: &child{I: 1}}
+
+	t.Run("test SaveContext() and LoadContext()", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		err := SaveContext(ctx, c, "test", opts, p1)
+		if err != nil {
+			t.Error(err)
+		}
+
+		p2 := &parent{}
+		err = LoadContext(ctx, c, "test", opts, p2)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(p1, p2) {
+			t.Error("loaded data not equal saved data")
+		}
+	})
+
+	t.Run("test SaveFieldsContext() and LoadFieldsContext()",
+		func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(),
+				time.Second)
+			defer cancel()
+
+			p1.Child.I = 2
+			err := SaveFieldsContext(ctx, c, "test", opts, p1, "Child")
+			if err != nil {
+				t.Error(err)
+			}
+
+			p2 := &parent{}
+			err = LoadFieldsContext(ctx, c, "test", opts, p2, "Child")
+			if err != nil {
+				t.Error(err)
+			} else if !reflect.DeepEqual(p1, p2) {
+				t.Error("loaded data not equal saved data")
+			}
+		})
+
+	t.Run("test LoadContext() canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		p2 := &parent{}
+		err := LoadContext(ctx, c, "test", opts, p2)
+		if !errors.Is(err, context.Canceled) {
+			t.Error(err)
+		} else if !reflect.DeepEqual(p2, &parent{}) {
+			t.Error("wrong value: ", p2)
+		}
+
+		err = SaveContext(ctx, c, "test", opts, p1)
+		if !errors.Is(err, context.Canceled) {
+			t.Error(err)
+		}
+
+		err = LoadFieldsContext(ctx, c, "test", opts, p2, "Child")
+		if !errors.Is(err, context.Canceled) {
+			t.Error(err)
+		}
+
+		err = SaveFieldsContext(ctx, c, "test", opts, p1, "Child")
+		if !errors.Is(err, context.Canceled) {
+			t.Error(err)
+		}
+	})
+}
+
+func TestLoadManyAndSaveMany(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	conn, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+	c := &flushCounter{Conn: conn}
+
+	type child struct {
+		I int
+	}
+
+	type user struct {
+		V     int `go_ohm:"version"`
+		Name  string
+		Ref   string
+		Child *child `go_ohm:"reference=Ref,non_json"`
+	}
+
+	keys := []string{"u1", "u2", "u3"}
+	users := []*user{
+		{Name: "1", Ref: "c1", Child: &child{I: 1}},
+		{Name: "2", Ref: "c2", Child: &child{I: 2}},
+		{Name: "3", Ref: "c3", Child: &child{I: 3}},
+	}
+
+	t.Run("test SaveMany()", func(t *testing.T) {
+		c.flushes = 0
+		err := SaveMany(c, "test", &ObjectOptions{}, keys, users)
+		if err != nil {
+			t.Error(err)
+		} else if c.flushes != 1 {
+			t.Error("wrong round trips: ", c.flushes)
+		}
+
+		if v := redisServer.HGet("test#child#c3", "I"); v != "3" {
+			t.Error("wrong value: ", v)
+		}
+	})
+
+	t.Run("test LoadMany()", func(t *testing.T) {
+		var loaded []user
+		c.flushes = 0
+		err := LoadMany(c, "test", &ObjectOptions{}, keys, &loaded)
+		if err != nil {
+			t.Error(err)
+		} else if c.flushes != 2 {
+			t.Error("wrong round trips: ", c.flushes)
+		}
+
+		for n := range users {
+			if !reflect.DeepEqual(users[n], &loaded[n]) {
+				t.Error("wrong value: ", loaded[n])
+			}
+		}
+	})
+
+	t.Run("test LoadMany() and SaveMany() partially failed", func(t *testing.T) {
+		var e *ErrorBatchFailed
+		var e2 *ErrorObjectNotFound
+		var e3 *ErrorVersionConflict
+
+		var loaded []*user
+		err := LoadMany(c, "test", &ObjectOptions{},
+			[]string{"u1", "u4", "u3"}, &loaded)
+		if !errors.As(err, &e) {
+			t.Error(err)
+		} else if e.Errors[0] != nil || !errors.As(e.Errors[1], &e2) ||
+			e.Errors[2] != nil {
+			t.Error(e.Errors)
+		} else if !reflect.DeepEqual(users[2], loaded[2]) || loaded[1] != nil {
+			t.Error("wrong value: ", loaded)
+		}
+
+		loaded[0].Name = "4"
+		loaded[2].Name = "4"
+		loaded[2].V = 0
+		err = SaveMany(c, "test", &ObjectOptions{},
+			[]string{"u1", "u3"}, []*user{loaded[0], loaded[2]})
+		if !errors.As(err, &e) {
+			t.Error(err)
+		} else if e.Errors[0] != nil || !errors.As(e.Errors[1], &e3) {
+			t.Error(e.Errors)
+		}
+
+		if v := redisServer.HGet("test#user#u1", "Name"); v != "4" {
+			t.Error("wrong value: ", v)
+		}
+		if v := redisServer.HGet("test#user#u3", "Name"); v != "3" {
+			t.Error("wrong value: ", v)
+		}
+	})
+
+	t.Run("test LoadMany() pointers with promoted struct", func(t *testing.T) {
+		type promoted struct {
+			P int
+		}
+
+		type embedding struct {
+			Name string
+			promoted
+		}
+
+		saved := []*embedding{{Name: "1", promoted: promoted{P: 1}},
+			{Name: "2", promoted: promoted{P: 2}}}
+		err := SaveMany(c, "test", &ObjectOptions{}, []string{"e1", "e2"},
+			saved)
+		if err != nil {
+			t.Error(err)
+		}
+
+		var loaded []*embedding
+		err = LoadMany(c, "test", &ObjectOptions{}, []string{"e1", "e2"},
+			&loaded)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(saved, loaded) {
+			t.Error("wrong value: ", loaded)
+		}
+	})
+}
+
+func TestStructSchema(t *testing.T) {
+	type cached struct {
+		i int
+		A int `go_ohm:"hash_field=a"`
+		B int `go_ohm:"-"`
+		C map[string]int
+	}
+
+	t.Run("test getStructSchema()", func(t *testing.T) {
+		typ := reflect.TypeOf(cached{})
+		schema := getStructSchema(typ)
+		if len(schema.fields) != 2 ||
+			schema.fields[0].nonJsonOpts.HashField != "a" ||
+			schema.fields[1].index != 3 {
+			t.Error("wrong schema: ", schema.fields)
+		}
+
+		if schema != getStructSchema(typ) {
+			t.Error("schema not cached")
+		}
+	})
+
+	t.Run("test getStructSchema() concurrently", func(t *testing.T) {
+		type concurrent struct {
+			A int
+			B *cached `go_ohm:"non_json,hash_name=b"`
+		}
+
+		done := make(chan error)
+		for n := 0; n < 8; n++ {
+			go func() {
+				_, err := genObjectList(&concurrent{}, ObjectOpLoad,
+					&ObjectOptions{HashName: "c"}, nil)
+				done <- err
+			}()
+		}
+
+		for n := 0; n < 8; n++ {
+			if err := <-done; err != nil {
+				t.Error(err)
+			}
+		}
+	})
+}
+
+func TestCodec(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	c, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+
+	type child struct {
+		S []string
+	}
+
+	type parent struct {
+		J     []string
+		G     []string       `go_ohm:"codec=gob"`
+		M     map[string]int `go_ohm:"hash_name=m,non_json"`
+		Child *child         `go_ohm:"hash_name=c,non_json,codec=json"`
+	}
+
+	p1 := &parent{
+		J:     []string{"j"},
+		G:     []string{"g"},
+		M:     map[string]int{"a": 1},
+		Child: &child{S: []string{"s"}},
+	}
+
+	t.Run("test field codec", func(t *testing.T) {
+		opts := &ObjectOptions{HashName: "p1"}
+		err := Save(c, "test", opts, p1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		j, _ := redis.String(c.Do("HGET", "test#parent#p1", "J"))
+		g, _ := redis.String(c.Do("HGET", "test#parent#p1", "G"))
+		if j != `["j"]` || g == `["g"]` {
+			t.Error("wrong encoding: ", j, g)
+		}
+
+		p2 := &parent{}
+		err = Load(c, "test", opts, p2)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(p1, p2) {
+			t.Error("wrong value: ", p2)
+		}
+	})
+
+	t.Run("test inherited codec", func(t *testing.T) {
+		opts := &ObjectOptions{HashName: "p2", Codec: "gob"}
+		err := Save(c, "test", opts, p1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		j, _ := redis.String(c.Do("HGET", "test#parent#p2", "J"))
+		m, _ := redis.String(c.Do("HGET", "test##m", "a"))
+		s, _ := redis.String(c.Do("HGET", "test#child#c", "S"))
+		if j == `["j"]` || m == "1" || s != `["s"]` {
+			t.Error("wrong encoding: ", j, m, s)
+		}
+
+		p2 := &parent{}
+		err = Load(c, "test", opts, p2)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(p1, p2) {
+			t.Error("wrong value: ", p2)
+		}
+
+		p3 := &parent{}
+		err = Load(c, "test", &ObjectOptions{HashName: "p2"}, p3)
+		if _, ok := err.(*ErrorJsonFailed); !ok {
+			t.Error(err)
+		}
+	})
+
+	t.Run("test unregistered codec", func(t *testing.T) {
+		opts := &ObjectOptions{HashName: "p3", Codec: "unknown"}
+		err := Save(c, "test", opts, p1)
+		var e *ErrorCodecFailed
+		if !errors.As(err, &e) {
+			t.Error(err)
+		}
+	})
+}
+
+// binaryPoint is stored by its binary methods, rather than json.
+type binaryPoint struct {
+	X, Y byte
+}
+
+func (p binaryPoint) MarshalBinary() ([]byte, error) {
+	return []byte{p.X, p.Y}, nil
+}
+
+func (p *binaryPoint) UnmarshalBinary(b []byte) error {
+	if len(b) != 2 {
+		return fmt.Errorf("invalid point")
+	}
+	p.X, p.Y = b[0], b[1]
+	return nil
+}
+
+func TestTextMarshaler(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	c, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+
+	type test struct {
+		IP    net.IP       `go_ohm:"marshaler"`
+		P     binaryPoint  `go_ohm:"marshaler"`
+		PP    *binaryPoint `go_ohm:"marshaler"`
+		J     binaryPoint  `go_ohm:"json"`
+		D     binaryPoint
+		Raw   net.IP
+		Map   map[string]binaryPoint
+		Empty *binaryPoint `go_ohm:"marshaler"`
+	}
+
+	opts := &ObjectOptions{HashName: "t1"}
+	t1 := &test{
+		IP:  net.ParseIP("1.2.3.4"),
+		P:   binaryPoint{1, 2},
+		PP:  &binaryPoint{3, 4},
+		J:   binaryPoint{5, 6},
+		D:   binaryPoint{9, 10},
+		Raw: net.IPv4(5, 6, 7, 8).To4(),
+		Map: map[string]binaryPoint{"a": {7, 8}},
+	}
+	err = Save(c, "test", opts, t1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := redis.StringMap(c.Do("HGETALL", "test#test#t1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"IP":    "1.2.3.4",
+		"P":     "\x01\x02",
+		"PP":    "\x03\x04",
+		"J":     `{"X":5,"Y":6}`,
+		"D":     `{"X":9,"Y":10}`,
+		"Raw":   "\x05\x06\x07\x08",
+		"Map":   `{"a":{"X":7,"Y":8}}`,
+		"Empty": "",
+	}
+	if !reflect.DeepEqual(rep, expected) {
+		t.Error("wrong layout: ", rep)
+	}
+
+	t2 := &test{}
+	err = Load(c, "test", opts, t2)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(t1, t2) {
+		t.Error("wrong value: ", t2)
+	}
+
+	_, err = c.Do("HSET", "test#test#t1", "P", "x")
+	if err != nil {
+		panic(err)
+	}
+
+	err = Load(c, "test", opts, &test{})
+	var e *ErrorCodecFailed
+	if !errors.As(err, &e) {
+		t.Error(err)
+	}
+
+	t.Run("test marshaler with compound options", func(t *testing.T) {
+		var e *ErrorInvalidStructTag
+		v1 := &struct {
+			P binaryPoint `go_ohm:"marshaler,hash_name=p"`
+		}{}
+		err := Save(c, "test", &ObjectOptions{HashName: "i1"}, v1)
+		if !errors.As(err, &e) {
+			t.Error(err)
+		}
+
+		v2 := &struct {
+			P binaryPoint `go_ohm:"marshaler,json"`
+		}{}
+		err = Save(c, "test", &ObjectOptions{HashName: "i2"}, v2)
+		if !errors.As(err, &e) {
+			t.Error(err)
+		}
+
+		v3 := &struct {
+			T time.Time `go_ohm:"time_format=unix,reference=R"`
+			R string
+		}{}
+		err = Save(c, "test", &ObjectOptions{HashName: "i3"}, v3)
+		if !errors.As(err, &e) {
+			t.Error(err)
+		}
+	})
+
+	t.Run("test marshaler on unsupported type", func(t *testing.T) {
+		var e *ErrorUnsupportedObjectType
+		v := &struct {
+			I int `go_ohm:"marshaler"`
+		}{}
+		err := Save(c, "test", &ObjectOptions{HashName: "u1"}, v)
+		if !errors.As(err, &e) {
+			t.Error(err)
+		}
+	})
+}
+
+func TestTimeFormat(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	c, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+
+	type test struct {
+		T    time.Time `go_ohm:"time_format=rfc3339nano"`
+		M    time.Time `go_ohm:"marshaler"`
+		Def  time.Time
+		U    time.Time  `go_ohm:"time_format=unix"`
+		UMs  *time.Time `go_ohm:"time_format=unix_ms"`
+		J    time.Time  `go_ohm:"json"`
+		D    time.Duration
+		DMs  time.Duration `go_ohm:"time_format=ms"`
+		DS   time.Duration `go_ohm:"time_format=s"`
+		DStr time.Duration `go_ohm:"time_format=string"`
+	}
+
+	loc := time.FixedZone("UTC+8", 8*3600)
+	ums := time.Date(2021, 1, 2, 3, 4, 5, 6000000, time.UTC)
+	opts := &ObjectOptions{HashName: "t1"}
+	t1 := &test{
+		T:    time.Date(2021, 1, 2, 3, 4, 5, 6, loc),
+		M:    time.Date(2021, 1, 2, 3, 4, 5, 6, loc),
+		Def:  time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+		U:    time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+		UMs:  &ums,
+		J:    time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+		D:    time.Second,
+		DMs:  time.Second,
+		DS:   time.Minute,
+		DStr: time.Minute,
+	}
+	err = Save(c, "test", opts, t1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := redis.StringMap(c.Do("HGETALL", "test#test#t1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"T":    "2021-01-02T03:04:05.000000006+08:00",
+		"M":    "2021-01-02T03:04:05.000000006+08:00",
+		"Def":  `"2021-01-02T03:04:05Z"`,
+		"U":    "1609556645",
+		"UMs":  "1609556645006",
+		"J":    `"2021-01-02T03:04:05Z"`,
+		"D":    "1000000000",
+		"DMs":  "1000",
+		"DS":   "60",
+		"DStr": "1m0s",
+	}
+	if !reflect.DeepEqual(rep, expected) {
+		t.Error("wrong layout: ", rep)
+	}
+
+	t2 := &test{}
+	err = Load(c, "test", opts, t2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !t2.T.Equal(t1.T) || !t2.M.Equal(t1.M) || t2.Def != t1.Def ||
+		t2.U != t1.U || *t2.UMs != *t1.UMs ||
+		t2.J != t1.J || t2.D != t1.D || t2.DMs != t1.DMs || t2.DS != t1.DS ||
+		t2.DStr != t1.DStr {
+		t.Error("wrong value: ", t2)
+	}
+
+	t.Run("test numeric commands", func(t *testing.T) {
+		_, err := c.Do("HINCRBY", "test#test#t1", "U", 60)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t3 := &test{}
+		err = Load(c, "test", opts, t3)
+		if err != nil {
+			t.Error(err)
+		} else if t3.U != t1.U.Add(time.Minute) {
+			t.Error("wrong value: ", t3.U)
+		}
+	})
+
+	t.Run("test invalid format", func(t *testing.T) {
+		type invalid struct {
+			T time.Time `go_ohm:"time_format=rfc822"`
+		}
+
+		err := Save(c, "test", &ObjectOptions{HashName: "i1"}, &invalid{})
+		if _, ok := err.(*ErrorInvalidStructTag); !ok {
+			t.Error(err)
+		}
+
+		type mismatched struct {
+			D time.Duration `go_ohm:"time_format=unix"`
+		}
+
+		err = Save(c, "test", &ObjectOptions{HashName: "m1"}, &mismatched{})
+		if _, ok := err.(*ErrorUnsupportedObjectType); !ok {
+			t.Error(err)
+		}
+	})
+}
+
+func TestIntegerParsing(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	c, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+
+	type test struct {
+		I8  int8
+		U64 uint64
+		F32 float32
+		M   map[int8]int `go_ohm:"hash_name=m,non_json"`
+	}
+
+	opts := &ObjectOptions{HashName: "t1"}
+	t1 := &test{I8: -128, U64: math.MaxUint64, F32: 1.5,
+		M: map[int8]int{127: 1}}
+	err = Save(c, "test", opts, t1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t2 := &test{}
+	err = Load(c, "test", opts, t2)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(t1, t2) {
+		t.Error("wrong value: ", t2)
+	}
+
+	// bad is the invalid value should be named by the error.
+	cases := []struct {
+		key, field, value, bad, typ string
+	}{
+		{"test#test#t1", "I8", "128", "128", "int8"},
+		{"test#test#t1", "U64", "-1", "-1", "uint64"},
+		{"test#test#t1", "U64", "18446744073709551616",
+			"18446744073709551616", "uint64"},
+		{"test#test#t1", "F32", "1e39", "1e39", "float32"},
+		{"test##m", "300", "1", "300", "int8"},
+	}
+
+	for _, cs := range cases {
+		redisServer.FlushAll()
+		err = Save(c, "test", opts, t1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = c.Do("HSET", cs.key, cs.field, cs.value)
+		if err != nil {
+			panic(err)
+		}
+
+		t3 := &test{}
+		err = Load(c, "test", opts, t3)
+		var e *ErrorInvalidValue
+		if !errors.As(err, &e) {
+			t.Error(cs, err)
+		} else if !strings.Contains(err.Error(), "'"+cs.bad+"'") ||
+			!strings.Contains(err.Error(), "'"+cs.typ+"'") {
+			t.Error(cs, err)
+		} else if !errors.Is(err, strconv.ErrRange) &&
+			!errors.Is(err, strconv.ErrSyntax) {
+			t.Error(cs, err)
+		}
+	}
+}
+
+func TestMapElemNonJson(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	c, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+
+	type test struct {
+		Name  string
+		Ints  map[string]int         `go_ohm:"hash_name=ints,non_json,elem_non_json"`
+		Strs  map[int]string         `go_ohm:"hash_name=strs,non_json,elem_non_json"`
+		Bytes map[string][]byte      `go_ohm:"hash_name=bytes,non_json,elem_non_json"`
+		Ptrs  map[string]*int        `go_ohm:"hash_name=ptrs,non_json,elem_non_json"`
+		Times map[string]time.Time   `go_ohm:"hash_name=times,non_json,elem_non_json,time_format=unix"`
+		Pts   map[string]binaryPoint `go_ohm:"hash_name=pts,non_json,elem_non_json,marshaler"`
+		Jsons map[string]int         `go_ohm:"hash_name=jsons,non_json"`
+	}
+
+	one := 1
+	opts := &ObjectOptions{HashName: "t1"}
+	t1 := &test{
+		Name:  "t1",
+		Ints:  map[string]int{"a": 1, "b": -2},
+		Strs:  map[int]string{1: "a", 2: ""},
+		Bytes: map[string][]byte{"a": []byte("b")},
+		Ptrs:  map[string]*int{"a": &one, "b": nil},
+		Times: map[string]time.Time{"a": time.Unix(100, 0).UTC()},
+		Pts:   map[string]binaryPoint{"a": {1, 2}},
+		Jsons: map[string]int{"a": 1},
+	}
+	err = Save(c, "test", opts, t1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]map[string]string{
+		"test##ints":  {"a": "1", "b": "-2"},
+		"test##strs":  {"1": "a", "2": ""},
+		"test##bytes": {"a": "b"},
+		"test##ptrs":  {"a": "1", "b": ""},
+		"test##times": {"a": "100"},
+		"test##pts":   {"a": "\x01\x02"},
+	}
+	for key, exp := range expected {
+		rep, err := redis.StringMap(c.Do("HGETALL", key))
+		if err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(rep, exp) {
+			t.Error("wrong layout: ", key, rep)
+		}
+	}
+
+	t2 := &test{}
+	err = Load(c, "test", opts, t2)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(t1, t2) {
+		t.Error("wrong value: ", t2)
+	}
+
+	t.Run("test numeric commands", func(t *testing.T) {
+		_, err := c.Do("HINCRBY", "test##ints", "a", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m := map[string]int{}
+		err = Load(c, "test", &ObjectOptions{HashName: "ints",
+			ElemNonJson: true}, &m)
+		if err != nil {
+			t.Error(err)
+		} else if m["a"] != 11 || m["b"] != -2 {
+			t.Error("wrong value: ", m)
+		}
+	})
+
+	t.Run("test invalid value", func(t *testing.T) {
+		_, err := c.Do("HSET", "test##ints", "a", "x")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = Load(c, "test", opts, &test{})
+		if _, ok := err.(*ErrorInvalidValue); !ok {
+			t.Error(err)
+		}
+	})
+
+	t.Run("test unsupported element type", func(t *testing.T) {
+		m := map[string][]string{"a": {"b"}}
+		err := Save(c, "test", &ObjectOptions{HashName: "m",
+			ElemNonJson: true}, m)
+		if _, ok := err.(*ErrorUnsupportedObjectType); !ok {
+			t.Error(err)
+		}
+
+		// marshaler elements require `Marshaler`.
+		pts := map[string]binaryPoint{"a": {1, 2}}
+		err = Save(c, "test", &ObjectOptions{HashName: "m",
+			ElemNonJson: true}, pts)
+		if _, ok := err.(*ErrorUnsupportedObjectType); !ok {
+			t.Error(err)
+		}
+	})
+}
+
+func TestMapMode(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	c, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+
+	type test struct {
+		Name    string
+		Merge   map[string]int `go_ohm:"hash_name=merge,non_json"`
+		Replace map[string]int `go_ohm:"hash_name=replace,non_json,map_mode=replace,ttl=1m"`
+	}
+
+	opts := &ObjectOptions{HashName: "t1"}
+	t1 := &test{
+		Name:    "t1",
+		Merge:   map[string]int{"a": 1, "b": 2},
+		Replace: map[string]int{"a": 1, "b": 2},
+	}
+	err = Save(c, "test", opts, t1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	delete(t1.Merge, "a")
+	delete(t1.Replace, "a")
+	err = Save(c, "test", opts, t1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t2 := &test{}
+	err = Load(c, "test", opts, t2)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(t2.Merge) != 2 || !reflect.DeepEqual(t2.Replace,
+		t1.Replace) {
+		t.Error("wrong value: ", t2)
+	} else if redisServer.TTL("test##replace") != time.Minute {
+		t.Error("wrong ttl: ", redisServer.TTL("test##replace"))
+	}
+
+	t.Run("test inherited mode", func(t *testing.T) {
+		err := Save(c, "test", &ObjectOptions{HashName: "t1",
+			MapMode: "replace", Atomic: true}, t1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t2 := &test{}
+		err = Load(c, "test", opts, t2)
+		if err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(t1, t2) {
+			t.Error("wrong value: ", t2)
+		}
+	})
+
+	t.Run("test empty map", func(t *testing.T) {
+		t1.Replace = map[string]int{}
+		err := Save(c, "test", opts, t1)
+		if err != nil {
+			t.Fatal(err)
+		} else if redisServer.Exists("test##replace") {
+			t.Error("hash not removed")
+		}
+	})
+
+	t.Run("test large map", func(t *testing.T) {
+		m := map[int]int{}
+		for i := 0; i < 3000; i++ {
+			m[i] = i
+		}
+
+		mopts := &ObjectOptions{HashName: "large", MapMode: "replace"}
+		err := Save(c, "test", mopts, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m2 := map[int]int{}
+		err = Load(c, "test", mopts, &m2)
+		if err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(m, m2) {
+			t.Error("wrong value: ", len(m2))
+		}
+	})
+
+	t.Run("test invalid mode", func(t *testing.T) {
+		type invalid struct {
+			M map[string]int `go_ohm:"hash_name=m,non_json,map_mode=x"`
+		}
+
+		err := Save(c, "test", opts, &invalid{})
+		if _, ok := err.(*ErrorInvalidStructTag); !ok {
+			t.Error(err)
+		}
+
+		err = Save(c, "test", &ObjectOptions{HashName: "m",
+			MapMode: "Replace"}, map[string]int{"a": 1})
+		if _, ok := err.(*ErrorInvalidValue); !ok {
+			t.Error(err)
+		} else if redisServer.Exists("test##m") {
+			t.Error("should not be saved")
+		}
+	})
+}
+
+func TestLoadMode(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	c, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+
+	type child struct {
+		I int
+	}
+
+	type test struct {
+		Name  string
+		S     string
+		P     *int
+		M     map[string]int `go_ohm:"hash_name=m,non_json"`
+		Child *child         `go_ohm:"hash_name=child,non_json"`
+	}
+
+	opts := &ObjectOptions{HashName: "t1"}
+	err = Save(c, "test", opts, &test{Name: "t1", M: map[string]int{"a": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newDst := func() *test {
+		i := 1
+		return &test{
+			Name:  "old",
+			S:     "old",
+			P:     &i,
+			M:     map[string]int{"a": 2, "b": 2},
+			Child: &child{I: 1},
+		}
+	}
+
+	t1 := newDst()
+	err = Load(c, "test", opts, t1)
+	if err != nil {
+		t.Fatal(err)
+	} else if t1.S != "old" || *t1.P != 1 || len(t1.M) != 2 ||
+		t1.Child.I != 1 {
+		t.Error("wrong merged value: ", t1)
+	}
+
+	t1 = newDst()
+	err = Load(c, "test", &ObjectOptions{HashName: "t1", LoadMode: "reset"},
+		t1)
+	if err != nil {
+		t.Fatal(err)
+	} else if t1.Name != "t1" || t1.S != "" || t1.P == nil || *t1.P != 0 ||
+		!reflect.DeepEqual(t1.M, map[string]int{"a": 1}) ||
+		t1.Child == nil || t1.Child.I != 0 {
+		t.Error("wrong reset value: ", t1)
+	}
+
+	t.Run("test struct tag", func(t *testing.T) {
+		type tagTest struct {
+			Name string
+			M    map[string]int `go_ohm:"hash_name=m,non_json,load_mode=reset"`
+		}
+
+		t1 := &tagTest{M: map[string]int{"b": 2}}
+		err := Load(c, "test", &ObjectOptions{HashName: "t1",
+			HashPrefix: "test"}, t1)
+		if err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(t1.M, map[string]int{"a": 1}) {
+			t.Error("wrong value: ", t1.M)
+		}
+	})
+
+	t.Run("test root map", func(t *testing.T) {
+		m := map[string]int{"b": 2}
+		err := Load(c, "test", &ObjectOptions{HashName: "m",
+			LoadMode: "reset"}, m)
+		if err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(m, map[string]int{"a": 1}) {
+			t.Error("wrong value: ", m)
+		}
+	})
+
+	t.Run("test hash unmarshaler", func(t *testing.T) {
+		mopts := &ObjectOptions{HashName: "marshaler", LoadMode: "reset"}
+		err := Save(c, "test", mopts, &marshalerTest{I: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		redisServer.HDel("test#marshalerTest#marshaler", "I")
+
+		t1 := &marshalerTest{I: 2}
+		err = Load(c, "test", mopts, t1)
+		if err != nil {
+			t.Fatal(err)
+		} else if t1.I != 0 || t1.unmarshals != 1 {
+			t.Error("wrong value: ", t1)
+		}
+	})
+
+	t.Run("test invalid mode", func(t *testing.T) {
+		type invalid struct {
+			M map[string]int `go_ohm:"hash_name=m,non_json,load_mode=x"`
+		}
+
+		err := Load(c, "test", opts, &invalid{})
+		if _, ok := err.(*ErrorInvalidStructTag); !ok {
+			t.Error(err)
+		}
+
+		m := map[string]int{}
+		err = Load(c, "test", &ObjectOptions{HashName: "m",
+			LoadMode: "clear"}, m)
+		if _, ok := err.(*ErrorInvalidValue); !ok {
+			t.Error(err)
+		}
+	})
+}
+
+// chunkedScanConn replies HSCAN in chunks of `count` fields sorted by name,
+// since miniredis ignores COUNT. The cursor is the offset of the next chunk.
+type chunkedScanConn struct {
+	redis.Conn
+	count  int
+	hscans int
+
+	// cursors of pending HSCAN replies, -1 means not HSCAN.
+	pending []int
+}
+
+func (c *chunkedScanConn) hscanArgs(cmd string,
+	args []interface{}) (string, []interface{}, int) {
+	if cmd != "HSCAN" {
+		return cmd, args, -1
+	}
+
+	c.hscans++
+	cursor, _ := strconv.Atoi(fmt.Sprint(args[1]))
+	return "HGETALL", args[:1], cursor
+}
+
+func (c *chunkedScanConn) hscanReply(cursor int, reply interface{},
+	err error) (interface{}, error) {
+	if cursor < 0 || err != nil {
+		return reply, err
+	}
+
+	m, err := redis.StringMap(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []string
+	for f := range m {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+
+	var pairs []interface{}
+	next := 0
+	for i := cursor; i < len(fields); i++ {
+		if i >= cursor+c.count {
+			next = i
+			break
+		}
+		pairs = append(pairs, []byte(fields[i]), []byte(m[fields[i]]))
+	}
+
+	return []interface{}{[]byte(strconv.Itoa(next)), pairs}, nil
+}
+
+func (c *chunkedScanConn) Do(cmd string, args ...interface{}) (interface{},
+	error) {
+	cmd, args, cursor := c.hscanArgs(cmd, args)
+	rep, err := c.Conn.Do(cmd, args...)
+	return c.hscanReply(cursor, rep, err)
+}
+
+func (c *chunkedScanConn) Send(cmd string, args ...interface{}) error {
+	cmd, args, cursor := c.hscanArgs(cmd, args)
+	c.pending = append(c.pending, cursor)
+	return c.Conn.Send(cmd, args...)
+}
+
+func (c *chunkedScanConn) Receive() (interface{}, error) {
+	cursor := c.pending[0]
+	c.pending = c.pending[1:]
+	rep, err := c.Conn.Receive()
+	return c.hscanReply(cursor, rep, err)
+}
+
+func TestScanMap(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	conn, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+	c := &chunkedScanConn{Conn: conn, count: 10}
+
+	m := map[int]*time.Duration{}
+	for i := 0; i < 25; i++ {
+		d := time.Duration(i) * time.Second
+		m[i] = &d
+	}
+
+	opts := &ObjectOptions{HashName: "m", ElemNonJson: true, ScanCount: 10}
+	err = Save(c, "test", opts, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m2 := map[int]*time.Duration{}
+	err = Load(c, "test", opts, m2)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(m, m2) {
+		t.Error("wrong value: ", m2)
+	} else if c.hscans != 3 {
+		t.Error("wrong HSCAN count: ", c.hscans)
+	}
+
+	t.Run("test struct tag", func(t *testing.T) {
+		type test struct {
+			Name string
+			M1   map[int]int `go_ohm:"hash_name=m1,non_json,elem_non_json,scan_count=10"`
+			M2   map[int]int `go_ohm:"hash_name=m2,non_json,elem_non_json,scan_count=10"`
+		}
+
+		t1 := &test{Name: "t1", M1: map[int]int{}, M2: map[int]int{}}
+		for i := 0; i < 25; i++ {
+			t1.M1[i] = i
+			t1.M2[i] = -i
+		}
+		err := Save(c, "test", &ObjectOptions{HashName: "t1"}, t1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t2 := &test{}
+		c.hscans = 0
+		fc := &flushCounter{Conn: c}
+		err = Load(fc, "test", &ObjectOptions{HashName: "t1"}, t2)
+		if err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(t1, t2) {
+			t.Error("wrong value: ", t2)
+		} else if c.hscans != 6 || fc.flushes != 3 {
+			// maps are scanned in the pipelines of the same level.
+			t.Error("wrong round trips: ", c.hscans, fc.flushes)
+		}
+	})
+
+	t.Run("test Load() merges pages", func(t *testing.T) {
+		extra := time.Hour
+		m3 := map[int]*time.Duration{100: &extra}
+		err := Load(c, "test", opts, m3)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(m3) != 26 || *m3[100] != extra ||
+			*m3[24] != 24*time.Second {
+			t.Error("wrong value: ", m3)
+		}
+	})
+
+	t.Run("test Load() decodes page by page", func(t *testing.T) {
+		redisServer.HSet("test##m", "0", "x")
+		defer redisServer.HSet("test##m", "0", "0")
+
+		c.hscans = 0
+		err := Load(c, "test", opts, map[int]*time.Duration{})
+		if _, ok := err.(*ErrorInvalidValue); !ok {
+			t.Error(err)
+		} else if c.hscans != 1 {
+			// stopped at the first page.
+			t.Error("wrong HSCAN count: ", c.hscans)
+		}
+	})
+
+	t.Run("test scan_count on non map", func(t *testing.T) {
+		type invalid struct {
+			I int `go_ohm:"scan_count=10"`
+		}
+
+		err := Load(c, "test", &ObjectOptions{HashName: "i1"}, &invalid{})
+		if _, ok := err.(*ErrorInvalidStructTag); !ok {
+			t.Error(err)
+		}
+
+		type valid struct {
+			I int
+		}
+
+		err = Load(c, "test", &ObjectOptions{HashName: "v1", ScanCount: 10},
+			&valid{})
+		if _, ok := err.(*ErrorInvalidValue); !ok {
+			t.Error(err)
+		}
+	})
+
+	t.Run("test scan map", func(t *testing.T) {
+		m2 := map[int]time.Duration{}
+		err := ScanMap(c, "test", opts, func(k int, v *time.Duration) error {
+			m2[k] = *v
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		} else if len(m2) != len(m) || m2[24] != 24*time.Second {
+			t.Error("wrong value: ", m2)
+		}
+
+		n := 0
+		stop := errors.New("stop")
+		err = ScanMap(c, "test", opts, func(k int, v *time.Duration) error {
+			n++
+			return stop
+		})
+		if err != stop || n != 1 {
+			t.Error(err, n)
+		}
+
+		err = ScanMap(c, "test", &ObjectOptions{HashName: "none"},
+			func(k string, v int) error {
+				t.Error("called on nonexistent hash")
+				return nil
+			})
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("test invalid func", func(t *testing.T) {
+		for _, fn := range []interface{}{nil, 1, func(k int) error {
+			return nil
+		}, func(k, v int) {}, func(k []int, v int) error {
+			return nil
+		}} {
+			err := ScanMap(c, "test", opts, fn)
+			if _, ok := err.(*ErrorUnsupportedObjectType); !ok {
+				t.Error(err)
+			}
+		}
+	})
+}
+
+func TestLoadMapKeys(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	conn, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+	c := &flushCounter{Conn: conn}
+
+	type key string
+
+	opts := &ObjectOptions{HashName: "m", TTL: time.Minute, SlidingTTL: true}
+	m := map[key]*int{}
+	for i := 0; i < 5; i++ {
+		v := i
+		m[key(strconv.Itoa(i))] = &v
+	}
+	err = Save(c, "test", opts, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	redisServer.SetTTL("test##m", time.Second)
+	one := 1
+	m2 := map[key]*int{"1": &one, "9": &one}
+	c.flushes = 0
+	missing, err := LoadMapKeys(c, "test", opts, &m2, key("3"), "4", "5")
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(missing, []interface{}{key("5")}) {
+		t.Error("wrong missing keys: ", missing)
+	} else if len(m2) != 4 || *m2["1"] != 1 || *m2["3"] != 3 ||
+		*m2["4"] != 4 || *m2["9"] != 1 {
+		t.Error("wrong value: ", m2)
+	} else if c.flushes != 1 {
+		t.Error("wrong round trips: ", c.flushes)
+	} else if redisServer.TTL("test##m") != time.Minute {
+		t.Error("wrong ttl: ", redisServer.TTL("test##m"))
+	}
+
+	t.Run("test reset mode", func(t *testing.T) {
+		m2 := map[key]*int{"9": &one}
+		missing, err := LoadMapKeys(c, "test", &ObjectOptions{HashName: "m",
+			LoadMode: "reset"}, m2, "9", "0")
+		if err != nil {
+			t.Fatal(err)
+		} else if len(missing) != 1 || len(m2) != 1 || *m2["0"] != 0 {
+			t.Error("wrong value: ", missing, m2)
+		}
+	})
+
+	t.Run("test context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		m3 := map[key]*int{}
+		_, err := LoadMapKeysContext(ctx, c, "test", opts, &m3, "2")
+		if err != nil {
+			t.Error(err)
+		} else if len(m3) != 1 || *m3["2"] != 2 {
+			t.Error("wrong value: ", m3)
+		}
+
+		cancel()
+		_, err = LoadMapKeysContext(ctx, c, "test", opts, &m3, "2")
+		if !errors.Is(err, context.Canceled) {
+			t.Error(err)
+		}
+	})
+
+	t.Run("test not found", func(t *testing.T) {
+		var m2 map[int]string
+		missing, err := LoadMapKeys(c, "test",
+			&ObjectOptions{HashName: "none"}, &m2, 1, 2)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(missing) != 2 || m2 == nil || len(m2) != 0 {
+			t.Error("wrong value: ", missing, m2)
+		}
+	})
+
+	t.Run("test invalid key", func(t *testing.T) {
+		for _, k := range []interface{}{nil, 1, []byte("1")} {
+			_, err := LoadMapKeys(c, "test", opts, &m2, k)
+			if _, ok := err.(*ErrorUnsupportedObjectType); !ok {
+				t.Error(err)
+			}
+		}
+
+		_, err := LoadMapKeys(c, "test", opts, &struct{ A int }{}, 1)
+		if _, ok := err.(*ErrorUnsupportedObjectType); !ok {
+			t.Error(err)
+		}
+	})
+}
+
+// textKey is a map key stored by its text methods.
+type textKey struct {
+	A, B int
+}
+
+func (k textKey) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d-%d", k.A, k.B)), nil
+}
+
+func (k *textKey) UnmarshalText(b []byte) error {
+	_, err := fmt.Sscanf(string(b), "%d-%d", &k.A, &k.B)
+	return err
+}
+
+// colorKey is a map key stored as integer, regardless of its marshalers.
+type colorKey int
+
+func (k colorKey) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("color%d", int(k))), nil
+}
+
+func (k *colorKey) UnmarshalText(b []byte) error {
+	_, err := fmt.Sscanf(string(b), "color%d", (*int)(k))
+	return err
+}
+
+// stringerKey is a map key stored as integer, regardless of String().
+type stringerKey int
+
+func (k stringerKey) String() string {
+	return "key" + strconv.Itoa(int(k))
+}
+
+func TestMapKeyTypes(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	c, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+
+	type name string
+
+	now := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	for _, m := range []interface{}{
+		map[float64]int{1.5: 1, -2: 2, 1e100: 3},
+		map[float32]int{0.1: 1},
+		map[bool]string{true: "t", false: "f"},
+		map[name]int{"a": 1, "": 2},
+		map[stringerKey]int{1: 1, 2: 2},
+		map[textKey]int{{1, 2}: 3},
+		map[binaryPoint]int{{1, 2}: 3},
+		map[time.Time]int{now: 1},
+		map[time.Duration]int{time.Second: 1},
+	} {
+		typ := reflect.TypeOf(m)
+		opts := &ObjectOptions{HashName: typ.String()}
+		err := Save(c, "test", opts, m)
+		if err != nil {
+			t.Fatal(typ, err)
+		}
+
+		m2 := reflect.New(typ)
+		err = Load(c, "test", opts, m2.Interface())
+		if err != nil {
+			t.Fatal(typ, err)
+		} else if !reflect.DeepEqual(m, m2.Elem().Interface()) {
+			t.Error("wrong value: ", m2.Elem())
+		}
+	}
+
+	fields := map[string]map[string]string{
+		"map[go_ohm.stringerKey]int": {"1": "1", "2": "2"},
+		"map[go_ohm.textKey]int":     {"1-2": "3"},
+		"map[time.Time]int":          {now.Format(time.RFC3339Nano): "1"},
+		"map[time.Duration]int":      {"1000000000": "1"},
+	}
+	for k, f := range fields {
+		rep, err := redis.StringMap(c.Do("HGETALL", "test##"+k))
+		if err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(rep, f) {
+			t.Error("wrong fields: ", k, rep)
+		}
+	}
+
+	t.Run("test primitive marshaler keys", func(t *testing.T) {
+		// written before keys were stored by marshalers.
+		redisServer.HSet("test##colors", "1", "2")
+		m := map[colorKey]int{}
+		err := Load(c, "test", &ObjectOptions{HashName: "colors"}, m)
+		if err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(m, map[colorKey]int{1: 2}) {
+			t.Error("wrong value: ", m)
+		}
+
+		err = Save(c, "test", &ObjectOptions{HashName: "colors"},
+			map[colorKey]int{2: 3})
+		if err != nil {
+			t.Fatal(err)
+		} else if v := redisServer.HGet("test##colors", "2"); v != "3" {
+			t.Error("wrong value: ", v)
+		}
+	})
+
+	t.Run("test load map keys", func(t *testing.T) {
+		m := map[textKey]int{}
+		missing, err := LoadMapKeys(c, "test",
+			&ObjectOptions{HashName: "map[go_ohm.textKey]int"}, m,
+			textKey{1, 2}, textKey{3, 4})
+		if err != nil {
+			t.Fatal(err)
+		} else if m[textKey{1, 2}] != 3 ||
+			!reflect.DeepEqual(missing, []interface{}{textKey{3, 4}}) {
+			t.Error("wrong value: ", m, missing)
+		}
+	})
+
+	t.Run("test invalid key", func(t *testing.T) {
+		redisServer.HSet("test##map[float64]int", "x", "1")
+		m := map[float64]int{}
+		err := Load(c, "test", &ObjectOptions{HashName: "map[float64]int"},
+			m)
+		var e *ErrorInvalidValue
+		if !errors.As(err, &e) {
+			t.Error(err)
+		}
+
+		err = Save(c, "test", &ObjectOptions{HashName: "x"},
+			map[struct{ A int }]int{})
+		if _, ok := err.(*ErrorUnsupportedObjectType); !ok {
+			t.Error(err)
+		}
+	})
+}
+
+// marshalerTest implements HashMarshaler and HashUnmarshaler by hand, and
+// counts calls.
+type marshalerChild struct {
+	I int
+}
+
+type marshalerTest struct {
+	I     int
+	Ref   string
+	Child *marshalerChild `go_ohm:"reference=Ref,non_json"`
+
+	marshals   int `go_ohm:"-"`
+	unmarshals int `go_ohm:"-"`
+}
+
+func (v *marshalerTest) HashFields() ([]interface{}, error) {
+	v.marshals++
+	return []interface{}{"I", strconv.Itoa(v.I), "Ref", v.Ref}, nil
+}
+
+func (v *marshalerTest) FromHash(fields map[string][]byte) error {
+	v.unmarshals++
+	if b := fields["I"]; len(b) > 0 {
+		i, err := ParseHashInt("I", b, "int", 0)
+		if err != nil {
+			return err
+		}
+		v.I = int(i)
+	}
+	v.Ref = string(fields["Ref"])
+	return nil
+}
+
+func TestHashMarshaler(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer redisServer.Close()
+
+	c, err := redis.Dial("tcp", redisServer.Addr())
+	if err != nil {
+		panic(err)
+	}
+
+	opts := &ObjectOptions{HashName: "m1"}
+	m1 := &marshalerTest{I: 1, Ref: "c1", Child: &marshalerChild{I: 2}}
+	err = Save(c, "test", opts, m1)
+	if err != nil {
+		t.Fatal(err)
+	} else if m1.marshals != 1 {
+		t.Error("HashFields() not called")
+	}
+
+	t.Run("test Load()", func(t *testing.T) {
+		m2 := &marshalerTest{}
+		err := Load(c, "test", opts, m2)
+		if err != nil {
+			t.Fatal(err)
+		} else if m2.unmarshals != 1 || m2.Child == nil {
+			t.Fatal("FromHash() not called")
+		}
+
+		if m2.I != 1 || m2.Ref != "c1" || m2.Child.I != 2 {
+			t.Error("wrong value: ", m2, m2.Child)
+		}
+	})
+
+	t.Run("test masks bypass generated methods", func(t *testing.T) {
+		m2 := &marshalerTest{}
+		err := LoadFields(c, "test", opts, m2, "I")
+		if err != nil {
+			t.Fatal(err)
+		} else if m2.unmarshals != 0 || m2.I != 1 {
+			t.Error("wrong value: ", m2)
+		}
+	})
+
+	t.Run("test invalid value", func(t *testing.T) {
+		_, err := c.Do("HSET", "test#marshalerTest#m1", "I", "x")
+		if err != nil {
+			panic(err)
+		}
+
+		err = Load(c, "test", opts, &marshalerTest{})
+		if _, ok := err.(*ErrorInvalidValue); !ok {
+			t.Error(err)
+		}
+	})
+}
+
+func BenchmarkGenObjectList(b *testing.B) {
+	type child struct {
+		I int
+		S string
+	}
+
+	type parent struct {
+		I     int
+		S     string
+		F     float64
+		B     []byte
+		Ref   string
+		Child *child         `go_ohm:"reference=Ref,non_json"`
+		M     map[string]int `go_ohm:"hash_name=m,non_json"`
+	}
+
+	opts := &ObjectOptions{HashName: "p"}
+	p := &parent{Ref: "c", Child: &child{}}
+	for n := 0; n < b.N; n++ {
+		_, err := genObjectList(p, ObjectOpSave, opts, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
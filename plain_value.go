@@ -0,0 +1,161 @@
+package go_ohm
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// formatValue formats the non jsonified value `v` of object `nam` with options
+// `opts`, which is shared by plain objects and elements of maps. Only
+// `TimeFormat` and `Marshaler` of `opts` are used.
+func formatValue(nam string, opts *ObjectOptions, v *reflect.Value) (string,
+	error) {
+	typ := v.Type()
+	if typ == timeType {
+		return FormatHashTime(nam, opts.TimeFormat, v.Interface().(time.Time))
+	} else if typ == durationType {
+		return FormatHashDuration(nam, opts.TimeFormat, time.Duration(v.Int()))
+	} else if opts.Marshaler && isMarshalerType(typ) {
+		return MarshalHashText(nam, addrOf(v))
+	}
+
+	if typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8 {
+		// byte slice.
+		return string(v.Bytes()), nil
+	}
+
+	return formatPlainValue(v), nil
+}
+
+// addrOf returns the pointer to the value, or to a copy of the value if it is
+// unaddressable.
+func addrOf(v *reflect.Value) interface{} {
+	if v.CanAddr() {
+		return v.Addr().Interface()
+	}
+
+	p := reflect.New(v.Type())
+	p.Elem().Set(*v)
+	return p.Interface()
+}
+
+// formatPlainValue formats primitive values by kind, so the result is not
+// affected by methods like String(), and is same as generated code's.
+func formatPlainValue(v *reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 32)
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	case reflect.Complex64:
+		return strconv.FormatComplex(v.Complex(), 'g', -1, 64)
+	case reflect.Complex128:
+		return strconv.FormatComplex(v.Complex(), 'g', -1, 128)
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// parseValue parses `b` into the non jsonified value `v` of object `nam`, which
+// must be settable. See formatValue().
+func parseValue(nam string, opts *ObjectOptions, b []byte,
+	v *reflect.Value) error {
+	typ := v.Type()
+	if typ == timeType {
+		t, err := ParseHashTime(nam, opts.TimeFormat, b)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	} else if typ == durationType {
+		d, err := ParseHashDuration(nam, opts.TimeFormat, b)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	} else if opts.Marshaler && isMarshalerType(typ) {
+		return UnmarshalHashText(nam, b, v.Addr().Interface())
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		v.SetString(string(b))
+
+	case reflect.Int:
+		fallthrough
+	case reflect.Int8:
+		fallthrough
+	case reflect.Int16:
+		fallthrough
+	case reflect.Int32:
+		fallthrough
+	case reflect.Int64:
+		i, err := ParseHashInt(nam, b, typ.String(), typ.Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+
+	case reflect.Uint:
+		fallthrough
+	case reflect.Uint8:
+		fallthrough
+	case reflect.Uint16:
+		fallthrough
+	case reflect.Uint32:
+		fallthrough
+	case reflect.Uint64:
+		fallthrough
+	case reflect.Uintptr:
+		u, err := ParseHashUint(nam, b, typ.String(), typ.Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+
+	case reflect.Bool:
+		bv, err := ParseHashBool(nam, b, typ.String())
+		if err != nil {
+			return err
+		}
+		v.SetBool(bv)
+
+	case reflect.Float32:
+		fallthrough
+	case reflect.Float64:
+		f, err := ParseHashFloat(nam, b, typ.String(), typ.Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+
+	case reflect.Complex64:
+		fallthrough
+	case reflect.Complex128:
+		c, err := ParseHashComplex(nam, b, typ.String(), typ.Bits())
+		if err != nil {
+			return err
+		}
+		v.SetComplex(c)
+
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			v.SetBytes(b)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package go_ohm
+
+import (
+	"context"
+	"reflect"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// ScanMap iterates entries of a map's redis hash by HSCAN, so huge maps are
+// neither loaded into memory nor block redis. Entries are decoded like Load()
+// does, and passed to `fn` chunk by chunk.
+//
+// `fn` must be a `func(K, V) error`, where `map[K]V` is the map type, EX:
+//
+//	err := ScanMap(conn, "ns", &ObjectOptions{HashName: "m"},
+//		func(k string, v int) error {
+//			...
+//		})
+//
+// `opts` is same as Load()'s for the map, and `opts.ScanCount` is the COUNT of
+// HSCAN, default is 100. If `fn` returns an error, it stops and returns the
+// error. `fn` is not called if the hash does not exist, and it may be called
+// more than once for an entry modified during iterating, as HSCAN does.
+func ScanMap(conn Conn, ns string, opts *ObjectOptions, fn interface{}) error {
+	return ScanMapContext(context.Background(), conn, ns, opts, fn)
+}
+
+// ScanMapContext is like ScanMap(), but with context. See LoadContext().
+func ScanMapContext(ctx context.Context, conn Conn, ns string,
+	opts *ObjectOptions, fn interface{}) error {
+	f := reflect.ValueOf(fn)
+	if !f.IsValid() || f.Kind() != reflect.Func {
+		return newErrorUnsupportedObjectType(rootObjectName)
+	}
+
+	ft := f.Type()
+	if ft.NumIn() != 2 || ft.NumOut() != 1 ||
+		ft.Out(0) != errorType || !ft.In(0).Comparable() {
+		return newErrorUnsupportedObjectType(rootObjectName)
+	}
+
+	mp := reflect.New(reflect.MapOf(ft.In(0), ft.In(1)))
+	objs, err := genObjectList(mp.Interface(), ObjectOpLoad, opts, nil)
+	if err != nil {
+		return err
+	}
+
+	mo := objs[0].abstractCompoundObject.(*mapObject)
+	key, err := mo.genRedisKey(ns)
+	if err != nil {
+		return err
+	}
+
+	count := opts.ScanCount
+	if count <= 0 {
+		count = scanCount
+	}
+
+	cursor := "0"
+	for {
+		rep, err := doContext(ctx, conn, "HSCAN", key, cursor, "COUNT", count)
+		if err != nil {
+			return newErrorRedisCommandFailed(mo.name, err)
+		}
+
+		var pairs []string
+		cursor, pairs, err = parseScanReply(rep)
+		if err != nil {
+			return newErrorRedisCommandFailed(mo.name, err)
+		}
+
+		for i := 0; i < len(pairs); i += 2 {
+			k, err := mo.newIndexValue(pairs[i])
+			if err != nil {
+				return err
+			}
+
+			v, err := mo.newElemValue(pairs[i+1], reflect.Value{})
+			if err != nil {
+				return err
+			}
+
+			ret := f.Call([]reflect.Value{*k, *v})
+			if !ret[0].IsNil() {
+				return ret[0].Interface().(error)
+			}
+		}
+
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package go_ohm
+
+import (
+	"reflect"
+	"sync"
+)
+
+// structSchema is the type level information of a struct, which is parsed only
+// once for every struct type and cached, so the object tree of the struct can
+// be built without parsing struct tags again.
+type structSchema struct {
+	// fields to map, unexported non-anonymous fields and fields with tag "-"
+	// are excluded.
+	fields []*fieldSchema
+}
+
+type fieldSchema struct {
+	index     int
+	name      string
+	anonymous bool
+	exported  bool
+
+	// declared type of the field.
+	typ reflect.Type
+
+	// The default of `Json` option depends on the field's concrete type, which
+	// may be determined by value if the field is an interface, so the struct
+	// tag is parsed with both defaults.
+	tag         string
+	tagErr      error
+	jsonOpts    *ObjectOptions
+	nonJsonOpts *ObjectOptions
+}
+
+// getOptions returns parsed options for the field's concrete type `typ`. The
+// options are shared by all objects of the field, so must not be modified.
+func (f *fieldSchema) getOptions(typ reflect.Type) *ObjectOptions {
+	// For primitive types, default to non json to improve performance, And for
+	// anonymous fields, default to non json to promote its fields.
+	if !isNativeType(typ, f.nonJsonOpts) && !f.anonymous {
+		return f.jsonOpts
+	}
+	return f.nonJsonOpts
+}
+
+// structSchemaCache caches schema of every struct type. The key is
+// reflect.Type, and value is *structSchema.
+var structSchemaCache sync.Map
+
+func getStructSchema(typ reflect.Type) *structSchema {
+	if v, ok := structSchemaCache.Load(typ); ok {
+		return v.(*structSchema)
+	}
+
+	schema := &structSchema{}
+	for i := 0; i < typ.NumField(); i++ {
+		fld := typ.Field(i)
+		if !fld.IsExported() && !fld.Anonymous {
+			continue
+		}
+
+		f := &fieldSchema{
+			index:       i,
+			name:        fld.Name,
+			anonymous:   fld.Anonymous,
+			exported:    fld.IsExported(),
+			typ:         fld.Type,
+			tag:         fld.Tag.Get(tagIdentifier),
+			jsonOpts:    &ObjectOptions{Json: true},
+			nonJsonOpts: &ObjectOptions{},
+		}
+
+		ignore, err := parseObjectOptions(f.tag, f.jsonOpts)
+		if err == nil {
+			_, err = parseObjectOptions(f.tag, f.nonJsonOpts)
+		}
+
+		if ignore {
+			continue
+		}
+
+		f.tagErr = err
+		schema.fields = append(schema.fields, f)
+	}
+
+	v, _ := structSchemaCache.LoadOrStore(typ, schema)
+	return v.(*structSchema)
+}
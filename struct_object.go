@@ -1,8 +1,11 @@
 package go_ohm
 
 import (
+	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
 )
@@ -12,6 +15,10 @@ type structObject struct {
 
 	// all exported fields of the struct, include anonymous struct.
 	fields []*object
+
+	// fields not selected by the mask but added by completeMask() to resolve
+	// keys of reference fields. They are loaded but not saved.
+	refSources map[string]struct{}
 }
 
 func (o *structObject) addField(obj *object) {
@@ -32,6 +39,44 @@ func (o *structObject) getFieldByName(name string) *object {
 	return nil
 }
 
+// findField finds the field by name, includes fields of promoted structs.
+func (o *structObject) findField(name string) *object {
+	for _, obj := range o.fields {
+		if obj.name == name {
+			return obj
+		} else if obj.isPromotedObject() {
+			so := obj.abstractObject.(*compoundObject).abstractCompoundObject.(*structObject)
+			if fld := so.findField(name); fld != nil {
+				return fld
+			}
+		}
+	}
+
+	return nil
+}
+
+// findFieldPath finds the field by path like "A.B", which means field "B" of
+// field "A". See findField().
+func (o *structObject) findFieldPath(path string) *object {
+	parts := strings.Split(path, ".")
+	so := o
+	for i, part := range parts {
+		fld := so.findField(part)
+		if fld == nil || i == len(parts)-1 {
+			return fld
+		} else if fld.isPlainObject() {
+			return nil
+		}
+
+		so, _ = fld.abstractObject.(*compoundObject).abstractCompoundObject.(*structObject)
+		if so == nil {
+			return nil
+		}
+	}
+
+	return nil
+}
+
 func (o *structObject) getPlainFields() []*plainObject {
 	var ret []*plainObject
 
@@ -48,6 +93,36 @@ func (o *structObject) getPlainFields() []*plainObject {
 	return ret
 }
 
+// getSavedPlainFields is like getPlainFields(), but excludes `refSources`.
+func (o *structObject) getSavedPlainFields() []*plainObject {
+	var ret []*plainObject
+
+	for _, obj := range o.fields {
+		if _, ok := o.refSources[obj.name]; ok {
+			continue
+		} else if obj.isPromotedObject() {
+			so := obj.abstractObject.(*compoundObject).abstractCompoundObject.(*structObject)
+			ret = append(ret, so.getSavedPlainFields()...)
+		} else if obj.isPlainObject() {
+			po := obj.abstractObject.(*plainObject)
+			ret = append(ret, po)
+		}
+	}
+
+	return ret
+}
+
+// getVersionField returns the plain field which has `version` option, or nil.
+func (o *structObject) getVersionField() *plainObject {
+	for _, po := range o.getPlainFields() {
+		if po.Version {
+			return po
+		}
+	}
+
+	return nil
+}
+
 func (o *structObject) getForeignObjects() []*compoundObject {
 	var ret []*compoundObject
 
@@ -80,10 +155,43 @@ func (o *structObject) genHashFields() []interface{} {
 	return args
 }
 
+// addressable returns the pointer to the struct if the struct is addressable,
+// all fields are selected, and the default codec is used, so its methods may
+// replace the reflective path.
+func (o *structObject) addressable() interface{} {
+	if o.mask != nil || o.value == nil || o.value.Kind() != reflect.Struct ||
+		!o.value.CanAddr() {
+		return nil
+	} else if c := o.getCodec(); c != "" && c != defaultCodecName {
+		return nil
+	}
+
+	p := o.value.Addr()
+	if !p.CanInterface() {
+		return nil
+	}
+
+	return p.Interface()
+}
+
+func (o *structObject) getHashMarshaler() HashMarshaler {
+	m, _ := o.addressable().(HashMarshaler)
+	return m
+}
+
+func (o *structObject) getHashUnmarshaler() HashUnmarshaler {
+	u, _ := o.addressable().(HashUnmarshaler)
+	return u
+}
+
 func (o *structObject) genHashFieldValuePairs() ([]interface{}, error) {
+	if m := o.getHashMarshaler(); m != nil {
+		return m.HashFields()
+	}
+
 	var args []interface{}
 
-	for _, obj := range o.getPlainFields() {
+	for _, obj := range o.getSavedPlainFields() {
 		k := obj.genHashField()
 		if k == "" {
 			return nil, newErrorUnsupportedObjectType(obj.name)
@@ -91,7 +199,7 @@ func (o *structObject) genHashFieldValuePairs() ([]interface{}, error) {
 
 		v, err := obj.genHashValue()
 		if err != nil {
-			return nil, newErrorUnsupportedObjectType(obj.name)
+			return nil, err
 		}
 
 		args = append(args, k, v)
@@ -100,37 +208,219 @@ func (o *structObject) genHashFieldValuePairs() ([]interface{}, error) {
 	return args, nil
 }
 
-func parseObjectOptions(t string, opts *ObjectOptions) bool {
+// versionedSaveScript saves the hash only if its version is as expected.
+// KEYS[1] is the hash, ARGV[1] is the version field, ARGV[2] is the expected
+// version, ARGV[3] is the expiration in milliseconds, 0 means no expiration,
+// and the others are field value pairs, includes the new version. The
+// expiration is set by the script, so a conflicted save does not refresh it.
+const versionedSaveScript = `
+local v = redis.call('HGET', KEYS[1], ARGV[1])
+if (v or '0') ~= ARGV[2] then
+	return false
+end
+for i = 4, #ARGV, 1000 do
+	redis.call('HMSET', KEYS[1], unpack(ARGV, i, math.min(i + 999, #ARGV)))
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+end
+return 1
+`
+
+// genVersionValue returns the current version of the version field `vf`, the
+// version of absent hashes is "0".
+func genVersionValue(vf *plainObject) (string, error) {
+	cur, err := vf.genHashValue()
+	if err != nil {
+		return "", err
+	} else if cur == "" {
+		cur = "0"
+	}
+
+	return cur, nil
+}
+
+// genVersionCheckCommands watches the hash and checks the version in redis is
+// same as the version field's. See compoundObject.genVersionCheckCommands().
+func (o *structObject) genVersionCheckCommands(key string,
+	vf *plainObject) ([]*redisCommand, error) {
+	cur, err := genVersionValue(vf)
+	if err != nil {
+		return nil, err
+	}
+
+	fld := vf.genHashField()
+	watch := newRedisCommand(o.compoundObject, "WATCH", []interface{}{key},
+		nil)
+	check := newRedisCommand(o.compoundObject, "HGET",
+		[]interface{}{key, fld}, func(reply interface{}) error {
+			v, err := redis.String(reply, nil)
+			if err == redis.ErrNil {
+				v = "0"
+			} else if err != nil {
+				return newErrorRedisCommandFailed(o.name, err)
+			}
+
+			if v != cur {
+				return newErrorVersionConflict(o.name)
+			}
+			return nil
+		})
+
+	return []*redisCommand{watch, check}, nil
+}
+
+// genVersionedSaveCommands replaces HMSET and PEXPIRE with
+// versionedSaveScript, and increases the version field after saved.
+func (o *structObject) genVersionedSaveCommands(key string,
+	pairs []interface{}, vf *plainObject) ([]*redisCommand, error) {
+	cur, err := genVersionValue(vf)
+	if err != nil {
+		return nil, err
+	}
+
+	var next string
+	if vf.typ.Kind() >= reflect.Uint {
+		u, err := strconv.ParseUint(cur, 10, 64)
+		if err != nil {
+			return nil, newErrorUnsupportedObjectType(vf.name)
+		}
+		next = strconv.FormatUint(u+1, 10)
+	} else {
+		i, err := strconv.ParseInt(cur, 10, 64)
+		if err != nil {
+			return nil, newErrorUnsupportedObjectType(vf.name)
+		}
+		next = strconv.FormatInt(i+1, 10)
+	}
+
+	fld := vf.genHashField()
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i] == fld {
+			pairs[i+1] = next
+		}
+	}
+
+	ttl, _ := o.getTTL()
+	args := []interface{}{versionedSaveScript, 1, key, fld, cur,
+		ttl.Milliseconds()}
+	args = append(args, pairs...)
+	cmd := newRedisCommand(o.compoundObject, "EVAL", args,
+		func(reply interface{}) error {
+			if reply == nil {
+				return newErrorVersionConflict(o.name)
+			}
+
+			if vf.value == nil {
+				// the struct itself is nil, nothing to update.
+				return nil
+			}
+
+			vf.reply = []byte(next)
+			return vf.renderValue()
+		})
+
+	return []*redisCommand{cmd}, nil
+}
+
+func parseObjectOptions(t string, opts *ObjectOptions) (bool, error) {
 	if t == "" {
-		return false
+		return false, nil
 	} else if t == "-" {
-		return true
+		return true, nil
 	}
 
-	processors := map[string]func(string){
-		"hash_prefix": func(v string) {
+	processors := map[string]func(string) error{
+		"hash_prefix": func(v string) error {
 			opts.HashPrefix = v
+			return nil
 		},
-		"hash_name": func(v string) {
+		"hash_name": func(v string) error {
 			opts.HashName = v
+			return nil
 		},
-		"hash_field": func(v string) {
+		"hash_field": func(v string) error {
 			opts.HashField = v
+			return nil
 		},
-		"reference": func(v string) {
+		"reference": func(v string) error {
 			opts.Reference = v
+			return nil
 		},
-		"json": func(v string) {
+		"json": func(v string) error {
 			opts.Json = true
+			return nil
 		},
-		"non_json": func(v string) {
+		"non_json": func(v string) error {
 			opts.Json = false
+			return nil
+		},
+		"marshaler": func(v string) error {
+			opts.Marshaler = true
+			return nil
 		},
-		"elem_json": func(v string) {
+		"elem_json": func(v string) error {
 			opts.ElemNonJson = false
+			return nil
 		},
-		"elem_non_json": func(v string) {
+		"elem_non_json": func(v string) error {
 			opts.ElemNonJson = true
+			return nil
+		},
+		"codec": func(v string) error {
+			opts.Codec = v
+			return nil
+		},
+		"time_format": func(v string) error {
+			if !isValidTimeFormat(v) {
+				return fmt.Errorf("unknown time format '%s'", v)
+			}
+			opts.TimeFormat = v
+			return nil
+		},
+		"map_mode": func(v string) error {
+			if v == "" || !isValidMapMode(v) {
+				return fmt.Errorf("unknown map mode '%s'", v)
+			}
+			opts.MapMode = v
+			return nil
+		},
+		"load_mode": func(v string) error {
+			if v == "" || !isValidLoadMode(v) {
+				return fmt.Errorf("unknown load mode '%s'", v)
+			}
+			opts.LoadMode = v
+			return nil
+		},
+		"scan_count": func(v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return err
+			} else if n <= 0 {
+				return fmt.Errorf("invalid scan count '%s'", v)
+			}
+			opts.ScanCount = n
+			return nil
+		},
+		"version": func(v string) error {
+			opts.Version = true
+			return nil
+		},
+		"required": func(v string) error {
+			opts.Required = true
+			return nil
+		},
+		"ttl": func(v string) error {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return err
+			}
+			opts.TTL = d
+			return nil
+		},
+		"sliding_ttl": func(v string) error {
+			opts.SlidingTTL = true
+			return nil
 		},
 	}
 
@@ -144,47 +434,100 @@ func parseObjectOptions(t string, opts *ObjectOptions) bool {
 				arg = pair[1]
 			}
 
-			proc(strings.TrimSpace(arg))
+			err := proc(strings.TrimSpace(arg))
+			if err != nil {
+				return false, err
+			}
 		}
 	}
 
-	return false
+	return false, nil
 }
 
-func (o *structObject) doRedisLoad(conn redis.Conn, ns string) error {
+func (o *structObject) genLoadCommands(ns string) ([]*redisCommand, error) {
 	key, err := o.genRedisKey(ns)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	// check if the hash exists explicitly in the same pipeline, HMGET can not
+	// tell an absent hash from a hash without the loaded fields.
+	cmd := newRedisCommand(o.compoundObject, "EXISTS", []interface{}{key},
+		func(reply interface{}) error {
+			n, err := redis.Int(reply, nil)
+			if err != nil {
+				return newErrorRedisCommandFailed(o.name, err)
+			}
+
+			o.notFound = n <= 0
+			return nil
+		})
+	cmds := []*redisCommand{cmd}
+
 	args := []interface{}{key}
 	args = append(args, o.genHashFields()...)
 	if len(args) <= 1 {
-		// nothing to do.
-		return nil
+		// no field to load.
+		return cmds, nil
 	}
 
-	rep, err := redis.ByteSlices(conn.Do("HMGET", args...))
-	if err != nil {
-		return newErrorRedisCommandFailed(o.name, err)
-	}
+	cmd = newRedisCommand(o.compoundObject, "HMGET", args,
+		func(reply interface{}) error {
+			rep, err := redis.ByteSlices(reply, nil)
+			if err != nil {
+				return newErrorRedisCommandFailed(o.name, err)
+			}
 
-	for i, po := range o.getPlainFields() {
-		po.reply = rep[i]
-	}
+			for i, po := range o.getPlainFields() {
+				po.reply = rep[i]
+			}
 
-	return nil
+			return nil
+		})
+	cmds = append(cmds, cmd)
+
+	return cmds, nil
 }
 
 func (o *structObject) renderValue() error {
 	o.createIndirectValues()
 
+	u := o.getHashUnmarshaler()
+	if u != nil {
+		// FromHash() sets existing fields only. Fields of newly created
+		// structs are zero already.
+		if o.indirect <= 0 && o.getLoadMode() == "reset" {
+			for _, po := range o.getPlainFields() {
+				po.resetValue()
+			}
+		}
+
+		fields := map[string][]byte{}
+		for _, po := range o.getPlainFields() {
+			if po.reply != nil {
+				fields[po.genHashField()] = po.reply
+			}
+		}
+
+		err := u.FromHash(fields)
+		if err != nil {
+			return err
+		}
+	}
+
 	for _, fo := range o.getFields() {
-		if o.indirect > 0 {
+		if o.indirect > 0 || fo.value == nil {
+			// the struct was nil, EX, a promoted struct of a nil parent, so
+			// its fields have no values yet.
 			fv := o.value.FieldByName(fo.name)
 			fo.value = &fv
 		}
 
+		if u != nil && fo.isPlainObject() {
+			// rendered by FromHash().
+			continue
+		}
+
 		err := fo.renderValue()
 		if err != nil {
 			return err
@@ -194,30 +537,61 @@ func (o *structObject) renderValue() error {
 	return nil
 }
 
-func (o *structObject) complete() error {
-	typ := o.typ
-	for i := 0; i < typ.NumField(); i++ {
-		fld := typ.Field(i)
-		fldNam := fld.Name
-		fldAnon := fld.Anonymous
-		fldTyp := fld.Type
-		fldVal := (*reflect.Value)(nil)
+// completeMask adds the fields referred by selected fields to the mask, since
+// they determine hash names of the selected fields.
+func (o *structObject) completeMask(schema *structSchema) error {
+	if o.mask == nil {
+		return nil
+	}
+
+	mask := fieldMask{}
+	for k, v := range o.mask {
+		mask[k] = v
+	}
+
+	for _, f := range schema.fields {
+		if _, ok := o.mask[f.name]; !ok {
+			continue
+		} else if f.tagErr != nil {
+			return newErrorInvalidStructTag(f.name, f.tag, f.tagErr)
+		}
 
-		if !fld.IsExported() {
-			if !fldAnon {
-				continue
+		ref := f.nonJsonOpts.Reference
+		if _, ok := mask[ref]; ref != "" && !ok {
+			mask[ref] = nil
+			if o.refSources == nil {
+				o.refSources = map[string]struct{}{}
 			}
+			o.refSources[ref] = struct{}{}
+		}
+	}
+
+	o.mask = mask
+	return nil
+}
 
+func (o *structObject) complete() error {
+	schema := getStructSchema(o.typ)
+	err := o.completeMask(schema)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range schema.fields {
+		fldTyp := f.typ
+		fldVal := (*reflect.Value)(nil)
+
+		if !f.exported {
 			// can not set unexported anonymous struct pointer field's value,
 			// should skip those cases.
 			if fldTyp.Kind() == reflect.Ptr {
-				if o.indirect > 0 {
+				if o.isNil() {
 					// Case 1, parent is nil. Even allocated new struct, the
 					// anonymous field is nil and can not be set.
 					continue
 				}
 
-				v := o.value.Field(i)
+				v := o.value.Field(f.index)
 				if v.IsNil() {
 					// Case 2, the anonymous field itself is nil.
 					continue
@@ -227,39 +601,65 @@ func (o *structObject) complete() error {
 			}
 		}
 
-		if fldVal == nil && o.indirect <= 0 {
-			v := o.value.Field(i)
+		if fldVal == nil && !o.isNil() {
+			v := o.value.Field(f.index)
 			fldVal = &v
 		}
 
 		fldTyp, fldVal, indirect := advanceIndirectTypeAndValue(fldTyp, fldVal)
 		if isIgnoredType(fldTyp) {
 			// do not support those types, skip.
-			return newErrorUnsupportedObjectType(fldNam)
+			return newErrorUnsupportedObjectType(f.name)
+		}
+
+		fldOpts := f.getOptions(fldTyp)
+		if f.tagErr != nil {
+			return newErrorInvalidStructTag(f.name, f.tag, f.tagErr)
 		}
 
-		fldOpts := &ObjectOptions{}
-		if !isPrimitiveType(fldTyp) && !fldAnon {
-			// For primitive types, default to non json to improve performance,
-			// And for anonymous fields, default to non json to promote its
-			// fields.
-			fldOpts.Json = true
+		if fldOpts.Version && (fldOpts.Json || !isIntegerType(fldTyp)) {
+			return newErrorUnsupportedObjectType(f.name)
+		} else if fldOpts.ScanCount > 0 && fldTyp.Kind() != reflect.Map {
+			return newErrorInvalidStructTag(f.name, f.tag,
+				fmt.Errorf("scan_count is for maps only"))
+		} else if fldOpts.Marshaler && fldTyp.Kind() != reflect.Map &&
+			!isMarshalerType(fldTyp) {
+			return newErrorUnsupportedObjectType(f.name)
+		} else if fldTyp.Kind() != reflect.Map &&
+			isNativeType(fldTyp, fldOpts) && !isPrimitiveType(fldTyp) &&
+			(fldOpts.Json || fldOpts.HashName != "" ||
+				fldOpts.Reference != "") {
+			// the value is stored by `marshaler` or `time_format`, so the
+			// options of jsonified or compound objects are meaningless.
+			return newErrorInvalidStructTag(f.name, f.tag, fmt.Errorf(
+				"conflicted with json, hash_name and reference"))
+		} else if !fldOpts.Json && fldTyp.Kind() != reflect.Map &&
+			!isTimeFormatSupported(fldTyp, fldOpts.TimeFormat) {
+			return newErrorUnsupportedObjectType(f.name)
 		}
 
-		ignore := parseObjectOptions(fld.Tag.Get(tagIdentifier), fldOpts)
-		if ignore {
+		// fields of promoted struct are selected by their own names, or all
+		// together by the struct's name, and the version field is always
+		// selected.
+		selected, fldMask := o.mask.selects(f.name)
+		if fldTyp.Kind() == reflect.Struct && f.anonymous && !fldOpts.Json &&
+			fldOpts.Reference == "" && fldOpts.HashName == "" &&
+			!isNativeType(fldTyp, fldOpts) {
+			selected, fldMask = true, o.mask.promotes(f.name)
+		} else if fldOpts.Version {
+			selected = true
+		}
+		if !selected {
 			continue
 		}
 
-		if o.op == ObjectOpLoad || fldOpts.Json ||
-			(fldTyp.Kind() != reflect.Struct && fldTyp.Kind() != reflect.Map) {
-			fldObj, err := newObject(fldNam, o.op, o.compoundObject, fldOpts,
-				fldTyp, fldVal, indirect, fldAnon)
-			if err != nil {
-				return err
-			}
-			o.addField(fldObj)
+		fldObj, err := newObject(f.name, o.op, o.compoundObject, fldOpts,
+			fldTyp, fldVal, indirect, f.anonymous, fldMask)
+		if err != nil {
+			return err
 		}
+
+		o.addField(fldObj)
 	}
 
 	return nil
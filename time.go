@@ -0,0 +1,137 @@
+package go_ohm
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+var timeFormats = map[string]bool{
+	"rfc3339nano": true,
+	"unix":        true,
+	"unix_ms":     true,
+}
+
+var durationFormats = map[string]bool{
+	"ns":     true,
+	"ms":     true,
+	"s":      true,
+	"string": true,
+}
+
+func isValidTimeFormat(format string) bool {
+	return timeFormats[format] || durationFormats[format]
+}
+
+// isTimeFormatSupported reports whether `format` is applicable to type `typ`.
+func isTimeFormatSupported(typ reflect.Type, format string) bool {
+	if typ == timeType {
+		return format == "" || timeFormats[format]
+	} else if typ == durationType {
+		return format == "" || durationFormats[format]
+	}
+
+	return format == ""
+}
+
+// FormatHashTime formats time `t` of field `name` by `format` like Save()
+// does, "" means "rfc3339nano". See `ObjectOptions.TimeFormat`.
+func FormatHashTime(name string, format string, t time.Time) (string, error) {
+	switch format {
+	case "", "rfc3339nano":
+		return t.Format(time.RFC3339Nano), nil
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10), nil
+	case "unix_ms":
+		return strconv.FormatInt(t.UnixMilli(), 10), nil
+	}
+
+	return "", newErrorInvalidStructTag(name, format,
+		fmt.Errorf("unknown time format"))
+}
+
+// ParseHashTime parses time of field `name` by `format` like Load() does.
+// Unix formats are parsed as UTC time.
+func ParseHashTime(name string, format string, b []byte) (time.Time, error) {
+	switch format {
+	case "", "rfc3339nano":
+		t, err := time.Parse(time.RFC3339Nano, string(b))
+		if err != nil {
+			return time.Time{}, newErrorInvalidValue(name, string(b),
+				timeType.String(), err)
+		}
+		return t, nil
+	case "unix", "unix_ms":
+		i, err := ParseHashInt(name, b, timeType.String(), 64)
+		if err != nil {
+			return time.Time{}, err
+		} else if format == "unix" {
+			return time.Unix(i, 0).UTC(), nil
+		}
+		return time.UnixMilli(i).UTC(), nil
+	}
+
+	return time.Time{}, newErrorInvalidStructTag(name, format,
+		fmt.Errorf("unknown time format"))
+}
+
+// FormatHashDuration formats duration `d` of field `name` by `format` like
+// Save() does, "" means "ns". See `ObjectOptions.TimeFormat`.
+func FormatHashDuration(name string, format string,
+	d time.Duration) (string, error) {
+	switch format {
+	case "", "ns":
+		return strconv.FormatInt(int64(d), 10), nil
+	case "ms":
+		return strconv.FormatInt(d.Milliseconds(), 10), nil
+	case "s":
+		return strconv.FormatInt(int64(d/time.Second), 10), nil
+	case "string":
+		return d.String(), nil
+	}
+
+	return "", newErrorInvalidStructTag(name, format,
+		fmt.Errorf("unknown duration format"))
+}
+
+// ParseHashDuration parses duration of field `name` by `format` like Load()
+// does.
+func ParseHashDuration(name string, format string,
+	b []byte) (time.Duration, error) {
+	unit := time.Nanosecond
+	switch format {
+	case "", "ns":
+	case "ms":
+		unit = time.Millisecond
+	case "s":
+		unit = time.Second
+	case "string":
+		d, err := time.ParseDuration(string(b))
+		if err != nil {
+			return 0, newErrorInvalidValue(name, string(b),
+				durationType.String(), err)
+		}
+		return d, nil
+	default:
+		return 0, newErrorInvalidStructTag(name, format,
+			fmt.Errorf("unknown duration format"))
+	}
+
+	i, err := ParseHashInt(name, b, durationType.String(), 64)
+	if err != nil {
+		return 0, err
+	}
+
+	d := time.Duration(i) * unit
+	if d/unit != time.Duration(i) {
+		return 0, newErrorInvalidValue(name, string(b), durationType.String(),
+			strconv.ErrRange)
+	}
+	return d, nil
+}